@@ -0,0 +1,113 @@
+/*
+Package benchtest provides benchmark comparisons against a stored baseline.
+
+Compare runs a benchmark and fails the test if it is significantly slower
+than the baseline:
+
+	func TestEncode_Performance(t *testing.T) {
+		benchtest.Compare(t, "testdata/encode.bench.json", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, _ = Encode(payload)
+			}
+		}, 20)
+	}
+
+The baseline is only written when the TESTUTILS_BENCH_UPDATE environment
+variable is set. A missing baseline fails the test.
+*/
+package benchtest
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// UpdateEnv is the environment variable that, when set, updates baselines.
+const UpdateEnv = "TESTUTILS_BENCH_UPDATE"
+
+// TestingT represents a partial *testing.T.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+	Logf(format string, args ...interface{})
+}
+
+// Baseline is a stored benchmark result.
+type Baseline struct {
+	NsPerOp     float64 `json:"nsPerOp"`
+	AllocsPerOp int64   `json:"allocsPerOp"`
+	BytesPerOp  int64   `json:"bytesPerOp"`
+}
+
+// Compare runs the benchmark and compares it to the baseline in the file,
+// failing the test if the time per operation regressed by more than
+// maxRegressionPct percent.
+func Compare(t TestingT, baselineFile string, fn func(b *testing.B), maxRegressionPct float64) {
+	t.Helper()
+
+	res := testing.Benchmark(fn)
+	if res.N == 0 {
+		t.Fatalf("Benchmark did not run")
+		return
+	}
+	got := Baseline{
+		NsPerOp:     float64(res.T.Nanoseconds()) / float64(res.N),
+		AllocsPerOp: res.AllocsPerOp(),
+		BytesPerOp:  res.AllocedBytesPerOp(),
+	}
+
+	if os.Getenv(UpdateEnv) != "" {
+		if err := writeBaseline(baselineFile, got); err != nil {
+			t.Fatalf("Unable to write baseline %s: %v", baselineFile, err)
+			return
+		}
+		t.Logf("Wrote baseline %s: %.2f ns/op", baselineFile, got.NsPerOp)
+		return
+	}
+
+	want, err := readBaseline(baselineFile)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		t.Fatalf("Baseline %s does not exist, set %s to create it", baselineFile, UpdateEnv)
+		return
+	case err != nil:
+		t.Fatalf("Unable to read baseline %s: %v", baselineFile, err)
+		return
+	}
+
+	if want.NsPerOp <= 0 {
+		t.Fatalf("Invalid baseline %s: %.2f ns/op", baselineFile, want.NsPerOp)
+		return
+	}
+	if pct := (got.NsPerOp - want.NsPerOp) / want.NsPerOp * 100; pct > maxRegressionPct {
+		t.Errorf("Expected at most %.1f%% regression but got %.1f%% (%.2f ns/op, baseline %.2f ns/op)",
+			maxRegressionPct, pct, got.NsPerOp, want.NsPerOp)
+	}
+}
+
+func readBaseline(name string) (Baseline, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return Baseline{}, err
+	}
+
+	var base Baseline
+	err = json.Unmarshal(b, &base)
+	return base, err
+}
+
+func writeBaseline(name string, base Baseline) error {
+	b, err := json.MarshalIndent(base, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(b, '\n'), 0o600)
+}
@@ -0,0 +1,106 @@
+package benchtest_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hamba/testutils/benchtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping benchmark in short mode")
+	}
+
+	file := filepath.Join(t.TempDir(), "bench.json")
+	err := os.WriteFile(file, []byte(`{"nsPerOp": 1000000000}`), 0o600)
+	require.NoError(t, err)
+
+	benchtest.Compare(t, file, benchJoin, 10)
+}
+
+func TestCompare_HandlesMissingBaseline(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping benchmark in short mode")
+	}
+
+	file := filepath.Join(t.TempDir(), "bench.json")
+
+	mockT := new(MockTestingT)
+	mockT.On("Helper")
+	mockT.On("Fatalf", "Baseline %s does not exist, set %s to create it", mock.Anything).Once()
+
+	benchtest.Compare(mockT, file, benchJoin, 10)
+
+	mockT.AssertExpectations(t)
+	assert.NoFileExists(t, file)
+}
+
+func TestCompare_WritesBaselineOnUpdate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping benchmark in short mode")
+	}
+
+	t.Setenv(benchtest.UpdateEnv, "1")
+	file := filepath.Join(t.TempDir(), "testdata", "bench.json")
+
+	mockT := new(MockTestingT)
+	mockT.On("Helper")
+	mockT.On("Logf", "Wrote baseline %s: %.2f ns/op", mock.Anything).Once()
+
+	benchtest.Compare(mockT, file, benchJoin, 10)
+
+	mockT.AssertExpectations(t)
+	assert.FileExists(t, file)
+}
+
+func TestCompare_HandlesRegression(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping benchmark in short mode")
+	}
+
+	file := filepath.Join(t.TempDir(), "bench.json")
+	err := os.WriteFile(file, []byte(`{"nsPerOp": 0.001}`), 0o600)
+	require.NoError(t, err)
+
+	mockT := new(MockTestingT)
+	mockT.On("Helper")
+	mockT.On("Errorf", "Expected at most %.1f%% regression but got %.1f%% (%.2f ns/op, baseline %.2f ns/op)", mock.Anything).Once()
+
+	benchtest.Compare(mockT, file, benchJoin, 10)
+
+	mockT.AssertExpectations(t)
+}
+
+func benchJoin(b *testing.B) {
+	parts := []string{"a", "b", "c"}
+	for i := 0; i < b.N; i++ {
+		_ = strings.Join(parts, ",")
+	}
+}
+
+type MockTestingT struct {
+	mock.Mock
+}
+
+func (m *MockTestingT) Helper() {
+	m.Called()
+}
+
+func (m *MockTestingT) Errorf(format string, args ...interface{}) {
+	m.Called(format, fmt.Sprint(args...))
+}
+
+func (m *MockTestingT) Fatalf(format string, args ...interface{}) {
+	m.Called(format, fmt.Sprint(args...))
+}
+
+func (m *MockTestingT) Logf(format string, args ...interface{}) {
+	m.Called(format, fmt.Sprint(args...))
+}
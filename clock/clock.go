@@ -0,0 +1,85 @@
+/*
+Package clock provides a time abstraction that can be controlled in tests.
+
+A fake clock can be used to fast-forward time instead of sleeping:
+
+	func TestFooBar(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+
+		p := retry.NewTimer(time.Minute, time.Second).WithClock(clk)
+		for p.Next() {
+			// This loop does not sleep.
+		}
+	}
+
+A frozen clock is pinned to a fixed time and only moves when ticked:
+
+	func TestExpiry(t *testing.T) {
+		clk := clock.Freeze(t, clock.MustParse(t, time.RFC3339, "2021-01-02T03:04:05Z"))
+
+		cache := NewCache(clk, time.Minute)
+		cache.Set("foo", "bar")
+
+		clk.Tick(2 * time.Minute)
+		// Assert "foo" has expired.
+	}
+*/
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock represents a source of time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Sleep pauses for at least the duration d.
+	Sleep(d time.Duration)
+}
+
+// Real is a clock backed by the time package.
+type Real struct{}
+
+// Now returns the current local time.
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Sleep pauses the current goroutine for at least the duration d.
+func (Real) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// Fake is a clock that only moves when slept on or advanced.
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake returns a fake clock set to the given time.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the current fake time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// Sleep advances the fake time by the duration d without blocking.
+func (f *Fake) Sleep(d time.Duration) {
+	f.Advance(d)
+}
+
+// Advance moves the fake time forward by the duration d.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+}
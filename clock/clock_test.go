@@ -0,0 +1,38 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hamba/testutils/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReal(t *testing.T) {
+	var clk clock.Clock = clock.Real{}
+
+	start := clk.Now()
+	clk.Sleep(10 * time.Millisecond)
+
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+}
+
+func TestFake_Sleep(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clk := clock.NewFake(now)
+
+	start := time.Now()
+	clk.Sleep(time.Hour)
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, now.Add(time.Hour), clk.Now())
+}
+
+func TestFake_Advance(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clk := clock.NewFake(now)
+
+	clk.Advance(time.Minute)
+
+	assert.Equal(t, now.Add(time.Minute), clk.Now())
+}
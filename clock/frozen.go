@@ -0,0 +1,113 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// TestingT represents a partial *testing.T.
+type TestingT interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+	Cleanup(fn func())
+}
+
+// Frozen is a clock pinned to a fixed time that only moves on Tick.
+type Frozen struct {
+	mu       sync.Mutex
+	now      time.Time
+	sleepers []sleeper
+	released bool
+}
+
+type sleeper struct {
+	until time.Time
+	done  chan struct{}
+}
+
+// Freeze returns a clock pinned to the given time for the duration of the test.
+//
+// Any goroutines sleeping on the clock are released when the test completes,
+// and later sleeps return immediately.
+func Freeze(t TestingT, at time.Time) *Frozen {
+	t.Helper()
+
+	f := &Frozen{now: at}
+	t.Cleanup(f.release)
+
+	return f
+}
+
+// Now returns the frozen time.
+func (f *Frozen) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// Sleep blocks until the clock has been ticked past the duration d.
+func (f *Frozen) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	f.mu.Lock()
+	if f.released {
+		f.mu.Unlock()
+		return
+	}
+	s := sleeper{until: f.now.Add(d), done: make(chan struct{})}
+	f.sleepers = append(f.sleepers, s)
+	f.mu.Unlock()
+
+	<-s.done
+}
+
+// Tick moves the frozen time forward by the duration d, waking any
+// sleepers that are due, and returns the new time.
+func (f *Frozen) Tick(d time.Duration) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+
+	sleepers := f.sleepers[:0]
+	for _, s := range f.sleepers {
+		if f.now.Before(s.until) {
+			sleepers = append(sleepers, s)
+			continue
+		}
+		close(s.done)
+	}
+	f.sleepers = sleepers
+
+	return f.now
+}
+
+// Format returns the frozen time formatted with the given layout.
+func (f *Frozen) Format(layout string) string {
+	return f.Now().Format(layout)
+}
+
+func (f *Frozen) release() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, s := range f.sleepers {
+		close(s.done)
+	}
+	f.sleepers = nil
+	f.released = true
+}
+
+// MustParse parses the value with the given layout, failing the test on error.
+func MustParse(t TestingT, layout, value string) time.Time {
+	t.Helper()
+
+	ts, err := time.Parse(layout, value)
+	if err != nil {
+		t.Fatalf("Unable to parse time %q: %v", value, err)
+	}
+	return ts
+}
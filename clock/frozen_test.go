@@ -0,0 +1,123 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hamba/testutils/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFrozen_Now(t *testing.T) {
+	at := clock.MustParse(t, time.RFC3339, "2021-01-02T03:04:05Z")
+	clk := clock.Freeze(t, at)
+
+	time.Sleep(10 * time.Millisecond)
+
+	assert.Equal(t, at, clk.Now())
+	assert.Equal(t, "2021-01-02T03:04:05Z", clk.Format(time.RFC3339))
+}
+
+func TestFrozen_Tick(t *testing.T) {
+	at := clock.MustParse(t, time.RFC3339, "2021-01-02T03:04:05Z")
+	clk := clock.Freeze(t, at)
+
+	got := clk.Tick(time.Hour)
+
+	assert.Equal(t, at.Add(time.Hour), got)
+	assert.Equal(t, at.Add(time.Hour), clk.Now())
+}
+
+func TestFrozen_Sleep(t *testing.T) {
+	clk := clock.Freeze(t, time.Now())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		clk.Sleep(time.Minute)
+	}()
+
+	// Allow the goroutine to start sleeping.
+	time.Sleep(10 * time.Millisecond)
+
+	clk.Tick(30 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("Expected sleep to block until ticked past its duration")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clk.Tick(30 * time.Second)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected sleep to return")
+	}
+}
+
+func TestFrozen_SleepReleasedOnCleanup(t *testing.T) {
+	done := make(chan struct{})
+
+	t.Run("sleep", func(t *testing.T) {
+		clk := clock.Freeze(t, time.Now())
+
+		go func() {
+			defer close(done)
+			clk.Sleep(time.Minute)
+		}()
+		// Allow the goroutine to start sleeping.
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected sleep to be released")
+	}
+}
+
+func TestFrozen_SleepAfterCleanup(t *testing.T) {
+	var clk *clock.Frozen
+	t.Run("freeze", func(t *testing.T) {
+		clk = clock.Freeze(t, time.Now())
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		clk.Sleep(time.Minute)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected sleep to return")
+	}
+}
+
+func TestMustParse_HandlesError(t *testing.T) {
+	mockT := new(MockTestingT)
+	mockT.On("Helper")
+	mockT.On("Fatalf", "Unable to parse time %q: %v", mock.Anything).Once()
+
+	clock.MustParse(mockT, time.RFC3339, "not a time")
+
+	mockT.AssertExpectations(t)
+}
+
+type MockTestingT struct {
+	mock.Mock
+}
+
+func (m *MockTestingT) Helper() {
+	m.Called()
+}
+
+func (m *MockTestingT) Fatalf(format string, args ...interface{}) {
+	m.Called(format, args)
+}
+
+func (m *MockTestingT) Cleanup(fn func()) {
+	m.Called(fn)
+}
@@ -0,0 +1,103 @@
+/*
+Package ctxtest provides assertions on context propagation.
+
+A marked context can be recognised in any context derived from it, catching
+code that replaces the context it was given, e.g. with context.Background():
+
+	func TestService_PropagatesContext(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		marked := ctxtest.Mark(ctx)
+
+		var got context.Context
+		repo := &fakeRepo{fn: func(ctx context.Context) { got = ctx }}
+		_ = NewService(repo).Do(marked)
+
+		marked.AssertPropagated(t, got)
+		ctxtest.AssertDeadline(t, got, 0, time.Second)
+	}
+*/
+package ctxtest
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// TestingT represents a partial *testing.T.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+type markKey struct{}
+
+// Marked is a context that can be recognised in contexts derived from it.
+type Marked struct {
+	context.Context
+
+	id *byte
+}
+
+// Mark returns a context derived from parent that can be recognised in
+// contexts derived from it.
+func Mark(parent context.Context) *Marked {
+	id := new(byte)
+	return &Marked{
+		Context: context.WithValue(parent, markKey{}, id),
+		id:      id,
+	}
+}
+
+// IsPropagated determines if ctx is the marked context or derived from it.
+func (m *Marked) IsPropagated(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	id, _ := ctx.Value(markKey{}).(*byte)
+	return id == m.id
+}
+
+// AssertPropagated asserts that ctx is the marked context or derived from it.
+func (m *Marked) AssertPropagated(t TestingT, ctx context.Context) bool {
+	t.Helper()
+
+	if !m.IsPropagated(ctx) {
+		t.Errorf("Expected context to be derived from the marked context")
+		return false
+	}
+	return true
+}
+
+// AssertDeadline asserts that ctx has a deadline with atLeast to atMost time remaining.
+func AssertDeadline(t TestingT, ctx context.Context, atLeast, atMost time.Duration) bool {
+	t.Helper()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		t.Errorf("Expected context to have a deadline but got none")
+		return false
+	}
+	if rem := time.Until(deadline); rem < atLeast || rem > atMost {
+		t.Errorf("Expected context deadline between %s and %s but got %s", atLeast, atMost, rem)
+		return false
+	}
+	return true
+}
+
+// AssertValue asserts that ctx carries the expected value for key.
+func AssertValue(t TestingT, ctx context.Context, key, want interface{}) bool {
+	t.Helper()
+
+	got := ctx.Value(key)
+	if got == nil {
+		t.Errorf("Expected context value for %v but got none", key)
+		return false
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Expected context value for %v to be %v but got %v", key, want, got)
+		return false
+	}
+	return true
+}
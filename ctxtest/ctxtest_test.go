@@ -0,0 +1,140 @@
+package ctxtest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hamba/testutils/ctxtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type ctxKey string
+
+func TestMarked_AssertPropagated(t *testing.T) {
+	marked := ctxtest.Mark(context.Background())
+	derived, cancel := context.WithCancel(context.WithValue(marked, ctxKey("a"), "b"))
+	t.Cleanup(cancel)
+
+	assert.True(t, marked.AssertPropagated(t, marked))
+	assert.True(t, marked.AssertPropagated(t, derived))
+}
+
+func TestMarked_AssertPropagatedHandlesOtherContext(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{
+			name: "background",
+			ctx:  context.Background(),
+		},
+		{
+			name: "other mark",
+			ctx:  ctxtest.Mark(context.Background()),
+		},
+		{
+			name: "nil",
+			ctx:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marked := ctxtest.Mark(context.Background())
+
+			mockT := new(MockTestingT)
+			mockT.On("Helper")
+			mockT.On("Errorf", "Expected context to be derived from the marked context", "").Once()
+
+			got := marked.AssertPropagated(mockT, tt.ctx)
+
+			assert.False(t, got)
+			mockT.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAssertDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	t.Cleanup(cancel)
+
+	assert.True(t, ctxtest.AssertDeadline(t, ctx, 500*time.Millisecond, time.Second))
+}
+
+func TestAssertDeadline_HandlesOutOfBounds(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	t.Cleanup(cancel)
+
+	mockT := new(MockTestingT)
+	mockT.On("Helper")
+	mockT.On("Errorf", "Expected context deadline between %s and %s but got %s", mock.Anything).Once()
+
+	got := ctxtest.AssertDeadline(mockT, ctx, 2*time.Second, 3*time.Second)
+
+	assert.False(t, got)
+	mockT.AssertExpectations(t)
+}
+
+func TestAssertDeadline_HandlesNoDeadline(t *testing.T) {
+	mockT := new(MockTestingT)
+	mockT.On("Helper")
+	mockT.On("Errorf", "Expected context to have a deadline but got none", "").Once()
+
+	got := ctxtest.AssertDeadline(mockT, context.Background(), 0, time.Second)
+
+	assert.False(t, got)
+	mockT.AssertExpectations(t)
+}
+
+func TestAssertValue(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ctxKey("id"), "123")
+
+	assert.True(t, ctxtest.AssertValue(t, ctx, ctxKey("id"), "123"))
+}
+
+func TestAssertValue_HandlesWrongValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		format string
+	}{
+		{
+			name:   "missing",
+			ctx:    context.Background(),
+			format: "Expected context value for %v but got none",
+		},
+		{
+			name:   "different",
+			ctx:    context.WithValue(context.Background(), ctxKey("id"), "456"),
+			format: "Expected context value for %v to be %v but got %v",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockT := new(MockTestingT)
+			mockT.On("Helper")
+			mockT.On("Errorf", tt.format, mock.Anything).Once()
+
+			got := ctxtest.AssertValue(mockT, tt.ctx, ctxKey("id"), "123")
+
+			assert.False(t, got)
+			mockT.AssertExpectations(t)
+		})
+	}
+}
+
+type MockTestingT struct {
+	mock.Mock
+}
+
+func (m *MockTestingT) Helper() {
+	m.Called()
+}
+
+func (m *MockTestingT) Errorf(format string, args ...interface{}) {
+	m.Called(format, fmt.Sprint(args...))
+}
@@ -0,0 +1,211 @@
+/*
+Package exectest provides stub executables for testing code that shells out.
+
+Stubs are placed on PATH, so commands run by name are intercepted without
+injecting a runner:
+
+	func TestDeploy(t *testing.T) {
+		kubectl := exectest.Stub(t, "kubectl").Returns("deployment.apps/api configured\n", 0)
+
+		err := Deploy()
+
+		require.NoError(t, err)
+		kubectl.AssertCalled(t, "apply", "-f", "api.yaml")
+	}
+*/
+package exectest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// TestingT represents a partial *testing.T.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+	TempDir() string
+	Setenv(key, value string)
+}
+
+// Invocation is a recorded call to a stub.
+type Invocation struct {
+	Args []string
+}
+
+// StubCmd is a stub executable on PATH.
+type StubCmd struct {
+	t    TestingT
+	name string
+	dir  string
+}
+
+// Stub creates a stub executable with the given name and prepends its
+// directory to PATH for the duration of the test. By default the stub
+// outputs nothing and exits successfully.
+//
+// Stubs are shell scripts and are not supported on Windows.
+func Stub(t TestingT, name string) *StubCmd {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Fatalf("Stub executables are not supported on %s", runtime.GOOS)
+		return nil
+	}
+
+	dir := t.TempDir()
+	s := &StubCmd{t: t, name: name, dir: dir}
+
+	script := "#!/bin/sh\n" +
+		"printf '%s\\0' \"$#\" \"$@\" >> " + quote(s.file("calls")) + "\n" +
+		"cat " + quote(s.file("stdout")) + "\n" +
+		"cat " + quote(s.file("stderr")) + " >&2\n" +
+		"exit \"$(cat " + quote(s.file("code")) + ")\"\n"
+	//nolint:gosec // The stub must be executable.
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+		t.Fatalf("Unable to write stub %s: %v", name, err)
+		return nil
+	}
+	s.write("calls", "")
+	s.write("stderr", "")
+	s.Returns("", 0)
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	return s
+}
+
+// Path returns the path of the stub executable.
+func (s *StubCmd) Path() string {
+	return filepath.Join(s.dir, s.name)
+}
+
+// Returns sets the stdout output and exit code of the stub.
+func (s *StubCmd) Returns(stdout string, code int) *StubCmd {
+	s.write("stdout", stdout)
+	s.write("code", strconv.Itoa(code))
+
+	return s
+}
+
+// Stderr sets the stderr output of the stub.
+func (s *StubCmd) Stderr(stderr string) *StubCmd {
+	s.write("stderr", stderr)
+
+	return s
+}
+
+// Invocations returns the recorded calls to the stub.
+func (s *StubCmd) Invocations() []Invocation {
+	s.t.Helper()
+
+	b, err := os.ReadFile(s.file("calls"))
+	if err != nil {
+		s.t.Fatalf("Unable to read calls of stub %s: %v", s.name, err)
+		return nil
+	}
+
+	var invs []Invocation
+	fields := bytes.Split(b, []byte{0})
+	for i := 0; i < len(fields)-1; {
+		n, err := strconv.Atoi(string(fields[i]))
+		if err != nil || i+1+n > len(fields)-1 {
+			s.t.Fatalf("Unable to parse calls of stub %s", s.name)
+			return nil
+		}
+
+		args := make([]string, n)
+		for j := range args {
+			args[j] = string(fields[i+1+j])
+		}
+		invs = append(invs, Invocation{Args: args})
+		i += 1 + n
+	}
+	return invs
+}
+
+// AssertCalled asserts the stub was called with the given arguments.
+func (s *StubCmd) AssertCalled(t TestingT, args ...string) {
+	t.Helper()
+
+	invs := s.Invocations()
+	for _, inv := range invs {
+		if argsEqual(inv.Args, args) {
+			return
+		}
+	}
+	t.Errorf("Expected a call to %s but got %s", formatCall(s.name, args), s.formatCalls(invs))
+}
+
+// AssertNotCalled asserts the stub was never called.
+func (s *StubCmd) AssertNotCalled(t TestingT) {
+	t.Helper()
+
+	if invs := s.Invocations(); len(invs) > 0 {
+		t.Errorf("Expected no calls to %s but got %s", s.name, s.formatCalls(invs))
+	}
+}
+
+// AssertNumberOfCalls asserts the stub was called n times.
+func (s *StubCmd) AssertNumberOfCalls(t TestingT, n int) {
+	t.Helper()
+
+	if got := len(s.Invocations()); got != n {
+		t.Errorf("Expected %s to be called %d times but got called %d times", s.name, n, got)
+	}
+}
+
+func argsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *StubCmd) formatCalls(invs []Invocation) string {
+	if len(invs) == 0 {
+		return "none"
+	}
+
+	calls := make([]string, 0, len(invs))
+	for _, inv := range invs {
+		calls = append(calls, formatCall(s.name, inv.Args))
+	}
+	return strings.Join(calls, ", ")
+}
+
+func formatCall(name string, args []string) string {
+	parts := make([]string, 0, len(args)+1)
+	parts = append(parts, name)
+	for _, arg := range args {
+		parts = append(parts, strconv.Quote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s *StubCmd) file(kind string) string {
+	return filepath.Join(s.dir, "."+s.name+"."+kind)
+}
+
+func (s *StubCmd) write(kind, data string) {
+	s.t.Helper()
+
+	if err := os.WriteFile(s.file(kind), []byte(data), 0o600); err != nil {
+		s.t.Fatalf("Unable to configure stub %s: %v", s.name, err)
+	}
+}
+
+// quote quotes s for use in a shell script.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,86 @@
+package exectest_test
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/hamba/testutils/exectest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub(t *testing.T) {
+	s := exectest.Stub(t, "mytool").Returns("some output\n", 0)
+
+	out, err := exec.Command("mytool", "apply", "-f", "it's a file.yaml").Output()
+
+	require.NoError(t, err)
+	assert.Equal(t, "some output\n", string(out))
+	want := []exectest.Invocation{{Args: []string{"apply", "-f", "it's a file.yaml"}}}
+	assert.Equal(t, want, s.Invocations())
+	s.AssertCalled(t, "apply", "-f", "it's a file.yaml")
+	s.AssertNumberOfCalls(t, 1)
+}
+
+func TestStub_ReturnsExitCodeAndStderr(t *testing.T) {
+	s := exectest.Stub(t, "mytool").Returns("", 3).Stderr("bad things\n")
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("mytool")
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 3, exitErr.ExitCode())
+	assert.Equal(t, "bad things\n", stderr.String())
+	s.AssertCalled(t)
+}
+
+func TestStub_RecordsMultipleCalls(t *testing.T) {
+	s := exectest.Stub(t, "mytool")
+
+	require.NoError(t, exec.Command("mytool", "a").Run())
+	require.NoError(t, exec.Command("mytool", "b", "").Run())
+
+	want := []exectest.Invocation{
+		{Args: []string{"a"}},
+		{Args: []string{"b", ""}},
+	}
+	assert.Equal(t, want, s.Invocations())
+	s.AssertNumberOfCalls(t, 2)
+}
+
+func TestStub_AssertNotCalled(t *testing.T) {
+	s := exectest.Stub(t, "mytool")
+
+	s.AssertNotCalled(t)
+}
+
+func TestStub_AssertionsFail(t *testing.T) {
+	s := exectest.Stub(t, "mytool")
+	require.NoError(t, exec.Command("mytool", "a").Run())
+
+	mockT := &recordingT{T: t}
+	s.AssertCalled(mockT, "b")
+	s.AssertNotCalled(mockT)
+	s.AssertNumberOfCalls(mockT, 2)
+
+	assert.Equal(t, []string{
+		`Expected a call to mytool "b" but got mytool "a"`,
+		`Expected no calls to mytool but got mytool "a"`,
+		`Expected mytool to be called 2 times but got called 1 times`,
+	}, mockT.errors)
+}
+
+type recordingT struct {
+	*testing.T
+
+	errors []string
+}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
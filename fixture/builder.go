@@ -0,0 +1,229 @@
+/*
+Package fixture provides helpers for constructing test data.
+
+Fluent builders can be generated for structs annotated with a
+"fixture:builder" comment:
+
+	//go:generate go run github.com/hamba/testutils/fixture/cmd/buildergen
+
+	//fixture:builder
+	type User struct {
+		Name  string
+		Email string
+	}
+
+Generating a NewUserBuilder function used as:
+
+	user := NewUserBuilder().WithName("bob").WithEmail("bob@example.com").Build()
+*/
+package fixture
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Annotation is the comment marking a struct for builder generation.
+const Annotation = "fixture:builder"
+
+// ErrNoBuilders is returned when the source has no annotated structs.
+var ErrNoBuilders = errors.New("fixture: no annotated structs found")
+
+// GenerateBuilders generates builders for all annotated structs in the Go source.
+func GenerateBuilders(filename string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{fset: fset, imports: map[string]string{}}
+	for _, imp := range file.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		name, spec := importName(path), imp.Path.Value
+		if imp.Name != nil {
+			name, spec = imp.Name.Name, imp.Name.Name+" "+imp.Path.Value
+		}
+		g.imports[name] = spec
+	}
+
+	var body bytes.Buffer
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok || ts.TypeParams != nil || !isAnnotated(gd.Doc, ts.Doc) {
+				continue
+			}
+			if err = g.writeBuilder(&body, ts.Name.Name, st); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if body.Len() == 0 {
+		return nil, ErrNoBuilders
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by buildergen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", file.Name.Name)
+	if len(g.used) > 0 {
+		out.WriteString("import (\n")
+		for _, name := range sortedKeys(g.used) {
+			fmt.Fprintf(&out, "\t%s\n", g.imports[name])
+		}
+		out.WriteString(")\n\n")
+	}
+	out.Write(body.Bytes())
+
+	return format.Source(out.Bytes())
+}
+
+// importName returns the conventional package name of the import path,
+// ignoring major version suffixes such as "gopkg.in/yaml.v3" and
+// "github.com/jackc/pgx/v5".
+func importName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && isMajorVersion(name) {
+		name = elems[len(elems)-2]
+	}
+	if i := strings.LastIndex(name, "."); i > 0 && isMajorVersion(name[i+1:]) {
+		name = name[:i]
+	}
+	return name
+}
+
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	for _, r := range s[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAnnotated(groups ...*ast.CommentGroup) bool {
+	for _, cg := range groups {
+		if cg == nil {
+			continue
+		}
+		for _, c := range cg.List {
+			if strings.TrimSpace(strings.TrimPrefix(c.Text, "//")) == Annotation {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type generator struct {
+	fset    *token.FileSet
+	imports map[string]string
+	used    map[string]bool
+}
+
+func (g *generator) writeBuilder(w *bytes.Buffer, name string, st *ast.StructType) error {
+	builder := name + "Builder"
+
+	fmt.Fprintf(w, "// %s builds %s values.\n", builder, name)
+	fmt.Fprintf(w, "type %s struct {\n\tv %s\n}\n\n", builder, name)
+	fmt.Fprintf(w, "// New%s returns a builder for %s.\n", builder, name)
+	fmt.Fprintf(w, "func New%s() *%s {\n\treturn &%s{}\n}\n\n", builder, builder, builder)
+
+	for _, field := range st.Fields.List {
+		typ, err := g.typeString(field.Type)
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(field.Names))
+		for _, n := range field.Names {
+			names = append(names, n.Name)
+		}
+		if len(names) == 0 {
+			names = append(names, embeddedName(field.Type))
+		}
+
+		for _, fieldName := range names {
+			if fieldName == "_" {
+				continue
+			}
+			method := "With" + upperFirst(fieldName)
+			fmt.Fprintf(w, "// %s sets %s.\n", method, fieldName)
+			fmt.Fprintf(w, "func (b *%s) %s(v %s) *%s {\n\tb.v.%s = v\n\treturn b\n}\n\n", builder, method, typ, builder, fieldName)
+		}
+	}
+
+	fmt.Fprintf(w, "// Build returns the built %s.\n", name)
+	fmt.Fprintf(w, "func (b *%s) Build() %s {\n\treturn b.v\n}\n\n", builder, name)
+	return nil
+}
+
+func (g *generator) typeString(expr ast.Expr) (string, error) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if id, ok := sel.X.(*ast.Ident); ok {
+			if _, ok = g.imports[id.Name]; ok {
+				if g.used == nil {
+					g.used = map[string]bool{}
+				}
+				g.used[id.Name] = true
+			}
+		}
+		return false
+	})
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, g.fset, expr); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	}
+	return "_"
+}
+
+func upperFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
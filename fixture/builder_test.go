@@ -0,0 +1,199 @@
+package fixture_test
+
+import (
+	"testing"
+
+	"github.com/hamba/testutils/fixture"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateBuilders(t *testing.T) {
+	src := `package models
+
+import (
+	"net/url"
+	"time"
+)
+
+//fixture:builder
+type User struct {
+	Name, Email string
+	CreatedAt   time.Time
+	tags        []string
+}
+
+type Ignored struct {
+	ID int
+}
+
+type (
+	// Order is an order.
+	//
+	//fixture:builder
+	Order struct {
+		*User
+		Callback *url.URL
+	}
+)
+`
+
+	got, err := fixture.GenerateBuilders("models.go", []byte(src))
+
+	require.NoError(t, err)
+	want := `// Code generated by buildergen. DO NOT EDIT.
+
+package models
+
+import (
+	"net/url"
+	"time"
+)
+
+// UserBuilder builds User values.
+type UserBuilder struct {
+	v User
+}
+
+// NewUserBuilder returns a builder for User.
+func NewUserBuilder() *UserBuilder {
+	return &UserBuilder{}
+}
+
+// WithName sets Name.
+func (b *UserBuilder) WithName(v string) *UserBuilder {
+	b.v.Name = v
+	return b
+}
+
+// WithEmail sets Email.
+func (b *UserBuilder) WithEmail(v string) *UserBuilder {
+	b.v.Email = v
+	return b
+}
+
+// WithCreatedAt sets CreatedAt.
+func (b *UserBuilder) WithCreatedAt(v time.Time) *UserBuilder {
+	b.v.CreatedAt = v
+	return b
+}
+
+// WithTags sets tags.
+func (b *UserBuilder) WithTags(v []string) *UserBuilder {
+	b.v.tags = v
+	return b
+}
+
+// Build returns the built User.
+func (b *UserBuilder) Build() User {
+	return b.v
+}
+
+// OrderBuilder builds Order values.
+type OrderBuilder struct {
+	v Order
+}
+
+// NewOrderBuilder returns a builder for Order.
+func NewOrderBuilder() *OrderBuilder {
+	return &OrderBuilder{}
+}
+
+// WithUser sets User.
+func (b *OrderBuilder) WithUser(v *User) *OrderBuilder {
+	b.v.User = v
+	return b
+}
+
+// WithCallback sets Callback.
+func (b *OrderBuilder) WithCallback(v *url.URL) *OrderBuilder {
+	b.v.Callback = v
+	return b
+}
+
+// Build returns the built Order.
+func (b *OrderBuilder) Build() Order {
+	return b.v
+}
+`
+	assert.Equal(t, want, string(got))
+}
+
+func TestGenerateBuilders_HandlesImportNames(t *testing.T) {
+	src := `package models
+
+import (
+	"github.com/jackc/pgx/v5"
+	uid "github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+//fixture:builder
+type Config struct {
+	ID   uid.UUID
+	Node *yaml.Node
+	Conn *pgx.Conn
+}
+`
+
+	got, err := fixture.GenerateBuilders("models.go", []byte(src))
+
+	require.NoError(t, err)
+	want := `// Code generated by buildergen. DO NOT EDIT.
+
+package models
+
+import (
+	uid "github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigBuilder builds Config values.
+type ConfigBuilder struct {
+	v Config
+}
+
+// NewConfigBuilder returns a builder for Config.
+func NewConfigBuilder() *ConfigBuilder {
+	return &ConfigBuilder{}
+}
+
+// WithID sets ID.
+func (b *ConfigBuilder) WithID(v uid.UUID) *ConfigBuilder {
+	b.v.ID = v
+	return b
+}
+
+// WithNode sets Node.
+func (b *ConfigBuilder) WithNode(v *yaml.Node) *ConfigBuilder {
+	b.v.Node = v
+	return b
+}
+
+// WithConn sets Conn.
+func (b *ConfigBuilder) WithConn(v *pgx.Conn) *ConfigBuilder {
+	b.v.Conn = v
+	return b
+}
+
+// Build returns the built Config.
+func (b *ConfigBuilder) Build() Config {
+	return b.v
+}
+`
+	assert.Equal(t, want, string(got))
+}
+
+func TestGenerateBuilders_NoAnnotatedStructs(t *testing.T) {
+	src := `package models
+
+type User struct {
+	Name string
+}
+`
+
+	_, err := fixture.GenerateBuilders("models.go", []byte(src))
+
+	assert.ErrorIs(t, err, fixture.ErrNoBuilders)
+}
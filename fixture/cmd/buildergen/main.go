@@ -0,0 +1,48 @@
+// Command buildergen generates fluent builders for annotated structs.
+//
+// It is intended to be run with go generate, reading the file named in the
+// GOFILE environment variable and writing the builders to <name>_builder.go.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hamba/testutils/fixture"
+)
+
+func main() {
+	if err := run(); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "buildergen:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	file := flag.String("file", os.Getenv("GOFILE"), "The Go source file containing annotated structs.")
+	output := flag.String("output", "", "The output file. Defaults to <file>_builder.go.")
+	flag.Parse()
+
+	if *file == "" {
+		return errors.New("no source file given")
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(*file, ".go") + "_builder.go"
+	}
+
+	src, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+
+	out, err := fixture.GenerateBuilders(*file, src)
+	if err != nil {
+		return err
+	}
+
+	//nolint:gosec // Generated source files should be readable.
+	return os.WriteFile(*output, out, 0o644)
+}
@@ -0,0 +1,136 @@
+/*
+Package fstest provides file system fixtures for testing file error handling.
+
+Files and directories can be created with exact permissions, restoring them
+when the test completes so temporary directories can still be removed:
+
+	func TestLoad_HandlesUnreadableFile(t *testing.T) {
+		if !fstest.PermissionsEnforced() {
+			t.Skip("Permissions are not enforced")
+		}
+
+		name := filepath.Join(t.TempDir(), "config.yaml")
+		fstest.WriteFile(t, name, []byte("key: value"), 0o000)
+
+		_, err := Load(name)
+
+		assert.ErrorIs(t, err, fs.ErrPermission)
+	}
+
+Where permissions cannot be relied on, such as when running as root,
+errors can be injected into an fs.FS with DenyFS. Code writing files can
+be tested against MemFS, an in-memory file system that can simulate a
+full disk, failing syncs or a read-only file system.
+*/
+package fstest
+
+import (
+	"io/fs"
+	"os"
+	"path"
+)
+
+// TestingT represents a partial *testing.T.
+type TestingT interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+	Cleanup(fn func())
+}
+
+// WriteFile writes data to the named file, creating it with exactly the
+// given permissions regardless of the umask.
+func WriteFile(t TestingT, name string, data []byte, perm fs.FileMode) {
+	t.Helper()
+
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatalf("Unable to write file %s: %v", name, err)
+		return
+	}
+	if err := os.Chmod(name, perm); err != nil {
+		t.Fatalf("Unable to set permissions on %s: %v", name, err)
+		return
+	}
+}
+
+// Mkdir creates the named directory with exactly the given permissions
+// regardless of the umask. The directory is made writable again when
+// the test completes, allowing it to be removed.
+func Mkdir(t TestingT, name string, perm fs.FileMode) {
+	t.Helper()
+
+	if err := os.Mkdir(name, 0o700); err != nil {
+		t.Fatalf("Unable to create directory %s: %v", name, err)
+		return
+	}
+	Chmod(t, name, perm)
+}
+
+// Chmod changes the permissions of the named file or directory,
+// restoring the original permissions when the test completes.
+func Chmod(t TestingT, name string, perm fs.FileMode) {
+	t.Helper()
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatalf("Unable to stat %s: %v", name, err)
+		return
+	}
+	if err = os.Chmod(name, perm); err != nil {
+		t.Fatalf("Unable to set permissions on %s: %v", name, err)
+		return
+	}
+
+	orig := fi.Mode().Perm()
+	if fi.IsDir() {
+		// Directories must be writable to remove their contents.
+		orig |= 0o700
+	}
+	t.Cleanup(func() {
+		_ = os.Chmod(name, orig)
+	})
+}
+
+// PermissionsEnforced determines if file permissions are enforced for the
+// current user. They are not enforced when running as root or on platforms
+// without Unix permissions, in which case permission tests should be skipped.
+func PermissionsEnforced() bool {
+	f, err := os.CreateTemp("", "fstest")
+	if err != nil {
+		return false
+	}
+	name := f.Name()
+	_ = f.Close()
+	defer func() { _ = os.Remove(name) }()
+
+	if err = os.Chmod(name, 0o000); err != nil {
+		return false
+	}
+	f, err = os.Open(name)
+	if err != nil {
+		return true
+	}
+	_ = f.Close()
+	return false
+}
+
+// DenyFS returns a file system that fails to open any name matching one of
+// the patterns with err, for example fs.ErrPermission or syscall.EROFS. Other
+// names are opened from fsys. Patterns use the syntax of path.Match.
+func DenyFS(fsys fs.FS, err error, patterns ...string) fs.FS {
+	return &denyFS{fsys: fsys, err: err, patterns: patterns}
+}
+
+type denyFS struct {
+	fsys     fs.FS
+	err      error
+	patterns []string
+}
+
+func (d *denyFS) Open(name string) (fs.File, error) {
+	for _, pattern := range d.patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: d.err}
+		}
+	}
+	return d.fsys.Open(name)
+}
@@ -0,0 +1,117 @@
+package fstest_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	gofstest "testing/fstest"
+
+	"github.com/hamba/testutils/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.txt")
+
+	fstest.WriteFile(t, name, []byte("test"), 0o400)
+
+	fi, err := os.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o400), fi.Mode().Perm())
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, "test", string(b))
+}
+
+func TestWriteFile_HandlesError(t *testing.T) {
+	mockT := new(MockTestingT)
+	mockT.On("Helper")
+	mockT.On("Fatalf", "Unable to write file %s: %v", mock.Anything).Once()
+
+	fstest.WriteFile(mockT, filepath.Join(t.TempDir(), "missing", "test.txt"), []byte("test"), 0o400)
+
+	mockT.AssertExpectations(t)
+}
+
+func TestMkdir(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dir")
+
+	t.Run("mkdir", func(t *testing.T) {
+		fstest.Mkdir(t, name, 0o500)
+
+		fi, err := os.Stat(name)
+		require.NoError(t, err)
+		assert.True(t, fi.IsDir())
+		assert.Equal(t, fs.FileMode(0o500), fi.Mode().Perm())
+	})
+
+	fi, err := os.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o700), fi.Mode().Perm())
+}
+
+func TestChmod(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.txt")
+	err := os.WriteFile(name, []byte("test"), 0o600)
+	require.NoError(t, err)
+
+	t.Run("chmod", func(t *testing.T) {
+		fstest.Chmod(t, name, 0o000)
+
+		fi, err := os.Stat(name)
+		require.NoError(t, err)
+		assert.Equal(t, fs.FileMode(0o000), fi.Mode().Perm())
+
+		if fstest.PermissionsEnforced() {
+			_, err = os.ReadFile(name)
+			assert.ErrorIs(t, err, fs.ErrPermission)
+		}
+	})
+
+	fi, err := os.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o600), fi.Mode().Perm())
+}
+
+func TestDenyFS(t *testing.T) {
+	fsys := fstest.DenyFS(gofstest.MapFS{
+		"config/app.yaml":  {Data: []byte("app")},
+		"config/db.yaml":   {Data: []byte("db")},
+		"secrets/key.pem":  {Data: []byte("key")},
+		"readme/readme.md": {Data: []byte("readme")},
+	}, syscall.EROFS, "secrets/*", "config/db.yaml")
+
+	b, err := fs.ReadFile(fsys, "config/app.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "app", string(b))
+
+	_, err = fs.ReadFile(fsys, "config/db.yaml")
+	assert.ErrorIs(t, err, syscall.EROFS)
+
+	_, err = fs.ReadFile(fsys, "secrets/key.pem")
+	var pathErr *fs.PathError
+	require.True(t, errors.As(err, &pathErr))
+	assert.Equal(t, "secrets/key.pem", pathErr.Path)
+}
+
+type MockTestingT struct {
+	mock.Mock
+}
+
+func (m *MockTestingT) Helper() {
+	m.Called()
+}
+
+func (m *MockTestingT) Fatalf(format string, args ...interface{}) {
+	m.Called(format, fmt.Sprint(args...))
+}
+
+func (m *MockTestingT) Cleanup(fn func()) {
+	m.Called(fn)
+}
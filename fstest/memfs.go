@@ -0,0 +1,273 @@
+package fstest
+
+import (
+	"io"
+	"io/fs"
+	"sync"
+	"syscall"
+	gofstest "testing/fstest"
+	"time"
+)
+
+// File is a file open for writing.
+type File interface {
+	io.Writer
+	Name() string
+	Sync() error
+	Close() error
+}
+
+// WriteFS is a file system that supports writing.
+type WriteFS interface {
+	fs.FS
+
+	// Create creates or truncates the named file.
+	Create(name string) (File, error)
+	// WriteFile writes data to the named file, creating it if necessary.
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	// MkdirAll creates the named directory along with any necessary parents.
+	MkdirAll(name string, perm fs.FileMode) error
+	// Remove removes the named file or empty directory.
+	Remove(name string) error
+}
+
+// MemFS is an in-memory file system with failure injection.
+//
+// Parent directories are created implicitly when writing files. Written data
+// is visible to readers once the file is synced or closed.
+type MemFS struct {
+	mu       sync.Mutex
+	files    gofstest.MapFS
+	capacity int64
+	syncErr  error
+	readOnly bool
+}
+
+var _ WriteFS = (*MemFS)(nil)
+
+// NewMemFS returns an empty in-memory file system.
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files:    gofstest.MapFS{},
+		capacity: -1,
+	}
+}
+
+// SetCapacity sets the total number of bytes the file system can hold.
+// Writes beyond the capacity fail with syscall.ENOSPC. A negative
+// capacity is unlimited.
+func (m *MemFS) SetCapacity(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.capacity = n
+}
+
+// FailSync makes syncing files fail with err, without writing the data.
+// The data is still written when the file is closed. A nil error stops
+// the failure.
+func (m *MemFS) FailSync(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.syncErr = err
+}
+
+// SetReadOnly makes all writes fail with syscall.EROFS.
+func (m *MemFS) SetReadOnly(readOnly bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.readOnly = readOnly
+}
+
+// Open opens the named file for reading.
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	snapshot := make(gofstest.MapFS, len(m.files))
+	for k, v := range m.files {
+		f := *v
+		snapshot[k] = &f
+	}
+	m.mu.Unlock()
+
+	return snapshot.Open(name)
+}
+
+// Create creates or truncates the named file.
+func (m *MemFS) Create(name string) (File, error) {
+	if err := m.WriteFile(name, nil, 0o666); err != nil {
+		return nil, err
+	}
+	return &memFile{fs: m, name: name, perm: 0o666}, nil
+}
+
+// WriteFile writes data to the named file, creating it if necessary.
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkWrite("write", name); err != nil {
+		return err
+	}
+	if f, ok := m.files[name]; ok && f.Mode.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: syscall.EISDIR}
+	}
+	if m.capacity >= 0 && m.usedExcept(name)+int64(len(data)) > m.capacity {
+		return &fs.PathError{Op: "write", Path: name, Err: syscall.ENOSPC}
+	}
+
+	m.files[name] = &gofstest.MapFile{
+		Data:    append([]byte(nil), data...),
+		Mode:    perm.Perm(),
+		ModTime: time.Now(),
+	}
+	return nil
+}
+
+// MkdirAll creates the named directory along with any necessary parents.
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkWrite("mkdir", name); err != nil {
+		return err
+	}
+	if f, ok := m.files[name]; ok {
+		if !f.Mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+		}
+		return nil
+	}
+
+	m.files[name] = &gofstest.MapFile{Mode: fs.ModeDir | perm.Perm(), ModTime: time.Now()}
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkWrite("remove", name); err != nil {
+		return err
+	}
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	for k := range m.files {
+		if len(k) > len(name) && k[:len(name)] == name && k[len(name)] == '/' {
+			return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+
+	delete(m.files, name)
+	return nil
+}
+
+func (m *MemFS) checkWrite(op, name string) error {
+	switch {
+	case !fs.ValidPath(name) || name == ".":
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	case m.readOnly:
+		return &fs.PathError{Op: op, Path: name, Err: syscall.EROFS}
+	}
+	return nil
+}
+
+func (m *MemFS) usedExcept(name string) int64 {
+	var n int64
+	for k, f := range m.files {
+		if k != name {
+			n += int64(len(f.Data))
+		}
+	}
+	return n
+}
+
+// commit stores the data written to a file.
+func (m *MemFS) commit(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkWrite("write", name); err != nil {
+		return err
+	}
+
+	m.files[name] = &gofstest.MapFile{Data: append([]byte(nil), data...), Mode: perm, ModTime: time.Now()}
+	return nil
+}
+
+type memFile struct {
+	fs   *MemFS
+	name string
+	perm fs.FileMode
+
+	mu     sync.Mutex
+	buf    []byte
+	closed bool
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	f.fs.mu.Lock()
+	err := f.fs.checkWrite("write", f.name)
+	capacity, used := f.fs.capacity, f.fs.usedExcept(f.name)
+	f.fs.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if capacity >= 0 {
+		if avail := capacity - used - int64(len(f.buf)); int64(len(p)) > avail {
+			if avail < 0 {
+				avail = 0
+			}
+			f.buf = append(f.buf, p[:avail]...)
+			return int(avail), &fs.PathError{Op: "write", Path: f.name, Err: syscall.ENOSPC}
+		}
+	}
+
+	f.buf = append(f.buf, p...)
+	return len(p), nil
+}
+
+func (f *memFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	f.fs.mu.Lock()
+	syncErr := f.fs.syncErr
+	f.fs.mu.Unlock()
+	if syncErr != nil {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: syncErr}
+	}
+
+	return f.fs.commit(f.name, f.buf, f.perm)
+}
+
+func (f *memFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+
+	return f.fs.commit(f.name, f.buf, f.perm)
+}
@@ -0,0 +1,130 @@
+package fstest_test
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+	"testing"
+	gofstest "testing/fstest"
+
+	"github.com/hamba/testutils/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemFS(t *testing.T) {
+	m := fstest.NewMemFS()
+
+	require.NoError(t, m.MkdirAll("config", 0o755))
+	require.NoError(t, m.WriteFile("config/app.yaml", []byte("app"), 0o644))
+	f, err := m.Create("data/db.bin")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("db"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	err = gofstest.TestFS(m, "config/app.yaml", "data/db.bin")
+	assert.NoError(t, err)
+	b, err := fs.ReadFile(m, "data/db.bin")
+	require.NoError(t, err)
+	assert.Equal(t, "db", string(b))
+}
+
+func TestMemFS_WritesVisibleAfterSync(t *testing.T) {
+	m := fstest.NewMemFS()
+
+	f, err := m.Create("test.txt")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("test"))
+	require.NoError(t, err)
+
+	b, err := fs.ReadFile(m, "test.txt")
+	require.NoError(t, err)
+	assert.Empty(t, b)
+
+	require.NoError(t, f.Sync())
+
+	b, err = fs.ReadFile(m, "test.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "test", string(b))
+}
+
+func TestMemFS_Remove(t *testing.T) {
+	m := fstest.NewMemFS()
+	require.NoError(t, m.MkdirAll("dir", 0o755))
+	require.NoError(t, m.WriteFile("dir/test.txt", []byte("test"), 0o644))
+
+	err := m.Remove("dir")
+	assert.ErrorIs(t, err, syscall.ENOTEMPTY)
+
+	require.NoError(t, m.Remove("dir/test.txt"))
+	require.NoError(t, m.Remove("dir"))
+
+	_, err = m.Open("dir")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	err = m.Remove("dir")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestMemFS_SetCapacity(t *testing.T) {
+	m := fstest.NewMemFS()
+	m.SetCapacity(10)
+	require.NoError(t, m.WriteFile("a.txt", []byte("123456"), 0o644))
+
+	err := m.WriteFile("b.txt", []byte("123456"), 0o644)
+	assert.ErrorIs(t, err, syscall.ENOSPC)
+
+	f, err := m.Create("b.txt")
+	require.NoError(t, err)
+	n, err := f.Write([]byte("123456"))
+	assert.ErrorIs(t, err, syscall.ENOSPC)
+	assert.Equal(t, 4, n)
+	require.NoError(t, f.Close())
+
+	b, err := fs.ReadFile(m, "b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "1234", string(b))
+}
+
+func TestMemFS_FailSync(t *testing.T) {
+	m := fstest.NewMemFS()
+	syncErr := errors.New("test")
+	m.FailSync(syncErr)
+
+	f, err := m.Create("test.txt")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("test"))
+	require.NoError(t, err)
+
+	err = f.Sync()
+	assert.ErrorIs(t, err, syncErr)
+
+	b, err := fs.ReadFile(m, "test.txt")
+	require.NoError(t, err)
+	assert.Empty(t, b)
+}
+
+func TestMemFS_SetReadOnly(t *testing.T) {
+	m := fstest.NewMemFS()
+	require.NoError(t, m.WriteFile("test.txt", []byte("test"), 0o644))
+	m.SetReadOnly(true)
+
+	err := m.WriteFile("test.txt", []byte("other"), 0o644)
+	assert.ErrorIs(t, err, syscall.EROFS)
+	_, err = m.Create("other.txt")
+	assert.ErrorIs(t, err, syscall.EROFS)
+	err = m.Remove("test.txt")
+	assert.ErrorIs(t, err, syscall.EROFS)
+
+	b, err := fs.ReadFile(m, "test.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "test", string(b))
+}
+
+func TestMemFS_HandlesInvalidPath(t *testing.T) {
+	m := fstest.NewMemFS()
+
+	err := m.WriteFile("../test.txt", []byte("test"), 0o644)
+
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+}
@@ -0,0 +1,288 @@
+/*
+Package fuzztest derives structured fuzz inputs from Go types.
+
+Fuzz targets can accept raw bytes and decode them into any value,
+letting the fuzzer explore structured inputs:
+
+	func FuzzApply(f *testing.F) {
+		seed, _ := fuzztest.Encode(Order{ID: "123", Items: []Item{{Qty: 1}}})
+		f.Add(seed)
+
+		f.Fuzz(func(t *testing.T, data []byte) {
+			var order Order
+			if err := fuzztest.Decode(data, &order); err != nil {
+				t.Fatal(err)
+			}
+
+			_ = Apply(order)
+		})
+	}
+
+Decoding never fails on the input bytes themselves. Values are filled
+until the input is exhausted, after which the remaining values are zero.
+Empty slices and maps are not distinguished from nil ones, and always
+decode as nil.
+*/
+package fuzztest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Decode fills the value pointed to by v from data. Exported struct fields,
+// slices, arrays, maps, pointers and all basic types are supported.
+func Decode(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("fuzztest: decode requires a non-nil pointer")
+	}
+
+	d := &decoder{data: data}
+	return d.decode(rv.Elem())
+}
+
+// Encode returns the data that decodes into v. It can be used to
+// add seed inputs to the fuzz corpus. Map entries are encoded in key order,
+// so equal values always encode to the same data.
+func Encode(v interface{}) ([]byte, error) {
+	e := &encoder{}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.data, nil
+}
+
+type decoder struct {
+	data []byte
+}
+
+func (d *decoder) bytes(n int) []byte {
+	b := make([]byte, n)
+	k := copy(b, d.data)
+	d.data = d.data[k:]
+	return b
+}
+
+func (d *decoder) uint64(size int) uint64 {
+	var buf [8]byte
+	copy(buf[:], d.bytes(size))
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+// length reads a length, limited to the remaining data to bound allocations.
+func (d *decoder) length() int {
+	n, k := binary.Uvarint(d.data)
+	if k <= 0 {
+		d.data = nil
+		return 0
+	}
+	d.data = d.data[k:]
+
+	if n > uint64(len(d.data)) {
+		n = uint64(len(d.data))
+	}
+	return int(n)
+}
+
+func (d *decoder) decode(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(d.uint64(1)&1 == 1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size := int(v.Type().Size())
+		u := d.uint64(size)
+		shift := 64 - 8*size
+		v.SetInt(int64(u<<shift) >> shift)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(d.uint64(int(v.Type().Size())))
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(uint32(d.uint64(4)))))
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(d.uint64(8)))
+	case reflect.Complex64:
+		re := math.Float32frombits(uint32(d.uint64(4)))
+		im := math.Float32frombits(uint32(d.uint64(4)))
+		v.SetComplex(complex(float64(re), float64(im)))
+	case reflect.Complex128:
+		re := math.Float64frombits(d.uint64(8))
+		im := math.Float64frombits(d.uint64(8))
+		v.SetComplex(complex(re, im))
+	case reflect.String:
+		v.SetString(string(d.bytes(d.length())))
+	case reflect.Slice:
+		n := d.length()
+		if n == 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(d.bytes(n))
+			return nil
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := d.decode(s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := d.decode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		n := d.length()
+		if n == 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		m := reflect.MakeMapWithSize(v.Type(), n)
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := d.decode(key); err != nil {
+				return err
+			}
+			val := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(val); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, val)
+		}
+		v.Set(m)
+	case reflect.Pointer:
+		if d.uint64(1)&1 == 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		p := reflect.New(v.Type().Elem())
+		if err := d.decode(p.Elem()); err != nil {
+			return err
+		}
+		v.Set(p)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			if err := d.decode(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("fuzztest: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+type encoder struct {
+	data []byte
+}
+
+func (e *encoder) uint64(u uint64, size int) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], u)
+	e.data = append(e.data, buf[:size]...)
+}
+
+func (e *encoder) length(n int) {
+	e.data = binary.AppendUvarint(e.data, uint64(n))
+}
+
+func (e *encoder) encode(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		var u uint64
+		if v.Bool() {
+			u = 1
+		}
+		e.uint64(u, 1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.uint64(uint64(v.Int()), int(v.Type().Size()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.uint64(v.Uint(), int(v.Type().Size()))
+	case reflect.Float32:
+		e.uint64(uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		e.uint64(math.Float64bits(v.Float()), 8)
+	case reflect.Complex64:
+		c := v.Complex()
+		e.uint64(uint64(math.Float32bits(float32(real(c)))), 4)
+		e.uint64(uint64(math.Float32bits(float32(imag(c)))), 4)
+	case reflect.Complex128:
+		c := v.Complex()
+		e.uint64(math.Float64bits(real(c)), 8)
+		e.uint64(math.Float64bits(imag(c)), 8)
+	case reflect.String:
+		e.length(v.Len())
+		e.data = append(e.data, v.String()...)
+	case reflect.Slice:
+		e.length(v.Len())
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.data = append(e.data, v.Bytes()...)
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		type entry struct {
+			key []byte
+			val reflect.Value
+		}
+		entries := make([]entry, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			ke := &encoder{}
+			if err := ke.encode(iter.Key()); err != nil {
+				return err
+			}
+			entries = append(entries, entry{key: ke.data, val: iter.Value()})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return bytes.Compare(entries[i].key, entries[j].key) < 0
+		})
+
+		e.length(len(entries))
+		for _, ent := range entries {
+			e.data = append(e.data, ent.key...)
+			if err := e.encode(ent.val); err != nil {
+				return err
+			}
+		}
+	case reflect.Pointer:
+		if v.IsNil() {
+			e.uint64(0, 1)
+			return nil
+		}
+		e.uint64(1, 1)
+		return e.encode(v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			if err := e.encode(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("fuzztest: unsupported type %s", v.Type())
+	}
+	return nil
+}
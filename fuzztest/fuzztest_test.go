@@ -0,0 +1,146 @@
+package fuzztest_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/hamba/testutils/fuzztest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	SKU   string
+	Qty   int16
+	Price float64
+}
+
+type order struct {
+	ID       string
+	Paid     bool
+	Total    int64
+	Discount *float32
+	Items    []item
+	Tags     map[string]uint8
+	Raw      []byte
+	Codes    [2]uint32
+	Note     complex64
+}
+
+func TestEncodeDecode(t *testing.T) {
+	discount := float32(0.5)
+	want := order{
+		ID:       "123",
+		Paid:     true,
+		Total:    -4200,
+		Discount: &discount,
+		Items: []item{
+			{SKU: "a", Qty: -1, Price: 1.5},
+			{SKU: "b", Qty: 2, Price: 2.25},
+		},
+		Tags:  map[string]uint8{"x": 1},
+		Raw:   []byte{1, 2, 3},
+		Codes: [2]uint32{7, 9},
+		Note:  complex(1, 2),
+	}
+
+	b, err := fuzztest.Encode(want)
+	require.NoError(t, err)
+
+	var got order
+	err = fuzztest.Decode(b, &got)
+
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestEncode_IsDeterministic(t *testing.T) {
+	v := map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5, "f": 6, "g": 7, "h": 8}
+
+	want, err := fuzztest.Encode(v)
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		got, err := fuzztest.Encode(v)
+
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestEncodeDecode_EmptyDecodesAsNil(t *testing.T) {
+	in := order{Items: []item{}, Tags: map[string]uint8{}, Raw: []byte{}}
+
+	b, err := fuzztest.Encode(in)
+	require.NoError(t, err)
+
+	var got order
+	err = fuzztest.Decode(b, &got)
+
+	require.NoError(t, err)
+	assert.Nil(t, got.Items)
+	assert.Nil(t, got.Tags)
+	assert.Nil(t, got.Raw)
+}
+
+func TestDecode_HandlesShortInput(t *testing.T) {
+	var got order
+	err := fuzztest.Decode([]byte{3, 'a', 'b'}, &got)
+
+	require.NoError(t, err)
+	assert.Equal(t, order{ID: "ab"}, got)
+}
+
+func TestDecode_HandlesArbitraryInput(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 1000; i++ {
+		b := make([]byte, rnd.Intn(256))
+		_, _ = rnd.Read(b)
+
+		var got order
+		err := fuzztest.Decode(b, &got)
+
+		require.NoError(t, err)
+	}
+}
+
+func TestDecode_HandlesNonPointer(t *testing.T) {
+	var got order
+	err := fuzztest.Decode([]byte{1}, got)
+
+	assert.Error(t, err)
+}
+
+func TestDecode_HandlesUnsupportedType(t *testing.T) {
+	var got struct {
+		Fn func()
+	}
+	err := fuzztest.Decode([]byte{1}, &got)
+
+	assert.Error(t, err)
+}
+
+func TestEncode_HandlesUnsupportedType(t *testing.T) {
+	_, err := fuzztest.Encode(struct{ Ch chan int }{})
+
+	assert.Error(t, err)
+}
+
+func FuzzDecode(f *testing.F) {
+	seed, err := fuzztest.Encode(order{ID: "123", Items: []item{{SKU: "a", Qty: 1}}})
+	require.NoError(f, err)
+	f.Add(seed)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var o order
+		if err := fuzztest.Decode(data, &o); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := fuzztest.Encode(o)
+		require.NoError(t, err)
+		var got order
+		require.NoError(t, fuzztest.Decode(b, &got))
+	})
+}
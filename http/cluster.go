@@ -0,0 +1,68 @@
+package http
+
+// Cluster is a set of named mock servers.
+type Cluster struct {
+	t TestingT
+
+	names   []string
+	servers map[string]*Server
+	seq     *Sequencer
+}
+
+// NewCluster creates a mock server for each of the given names.
+//
+// All servers are registered with the cluster Sequencer.
+func NewCluster(t TestingT, names ...string) *Cluster {
+	t.Helper()
+
+	c := &Cluster{
+		t:       t,
+		names:   names,
+		servers: make(map[string]*Server, len(names)),
+		seq:     NewSequencer(t),
+	}
+	for _, name := range names {
+		srv := NewServer(t)
+		c.seq.Register(name, srv)
+		c.servers[name] = srv
+	}
+
+	return c
+}
+
+// Server returns the mock server with the given name.
+func (c *Cluster) Server(name string) *Server {
+	srv, ok := c.servers[name]
+	if !ok {
+		fatalf(c.t, "Unknown server %q in cluster", name)
+	}
+	return srv
+}
+
+// URLs returns the url of each mock server, keyed by name.
+func (c *Cluster) URLs() map[string]string {
+	urls := make(map[string]string, len(c.servers))
+	for name, srv := range c.servers {
+		urls[name] = srv.URL()
+	}
+	return urls
+}
+
+// Sequencer returns the sequencer recording requests to all servers.
+func (c *Cluster) Sequencer() *Sequencer {
+	return c.seq
+}
+
+// AssertAllExpectations asserts all expectations have been met on all servers.
+func (c *Cluster) AssertAllExpectations() {
+	for _, name := range c.names {
+		c.servers[name].AssertExpectations()
+	}
+}
+
+// Close closes all servers.
+func (c *Cluster) Close() {
+	for _, name := range c.names {
+		c.servers[name].Close()
+	}
+}
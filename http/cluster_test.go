@@ -0,0 +1,44 @@
+package http_test
+
+import (
+	"net/http"
+	"testing"
+
+	httptest "github.com/hamba/testutils/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCluster(t *testing.T) {
+	c := httptest.NewCluster(t, "auth", "billing")
+	t.Cleanup(c.Close)
+
+	c.Server("auth").On(http.MethodGet, "/login")
+	c.Server("billing").On(http.MethodGet, "/charge")
+
+	urls := c.URLs()
+	assert.Len(t, urls, 2)
+	assert.Equal(t, c.Server("auth").URL(), urls["auth"])
+	assert.Equal(t, c.Server("billing").URL(), urls["billing"])
+
+	doGet(t, urls["auth"]+"/login")
+	doGet(t, urls["billing"]+"/charge")
+
+	c.AssertAllExpectations()
+	c.Sequencer().AssertCalledBefore("auth", "billing")
+}
+
+func TestCluster_AssertAllExpectations(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Expected a call to %s but got none", mock.Anything) })
+
+	c := httptest.NewCluster(mockT, "auth", "billing")
+	t.Cleanup(c.Close)
+
+	c.Server("auth").On(http.MethodGet, "/login")
+	c.Server("billing").On(http.MethodGet, "/charge")
+
+	doGet(t, c.Server("auth").URL()+"/login")
+
+	c.AssertAllExpectations()
+}
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// JournalEntry is a request and its response recorded in a journal.
+// The status is zero when the connection was dropped without a response.
+type JournalEntry struct {
+	Time           time.Time     `json:"time"`
+	Method         string        `json:"method"`
+	URL            string        `json:"url"`
+	Header         http.Header   `json:"header,omitempty"`
+	Body           string        `json:"body,omitempty"`
+	Matched        string        `json:"matched"`
+	Status         int           `json:"status"`
+	ResponseHeader http.Header   `json:"responseHeader,omitempty"`
+	ResponseBody   string        `json:"responseBody,omitempty"`
+	Duration       time.Duration `json:"duration"`
+}
+
+type journal struct {
+	mu     sync.Mutex
+	f      *os.File
+	closed bool
+}
+
+func openJournal(path string) (*journal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{f: f}, nil
+}
+
+func (j *journal) write(start time.Time, req Request, matched string, rec *statusRecorder, dur time.Duration) {
+	entry := JournalEntry{
+		Time:           start,
+		Method:         req.Method,
+		Header:         req.Header,
+		Body:           string(req.Body),
+		Matched:        matched,
+		Status:         rec.status,
+		ResponseHeader: rec.Header(),
+		ResponseBody:   string(rec.body),
+		Duration:       dur,
+	}
+	if req.URL != nil {
+		entry.URL = req.URL.String()
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return
+	}
+	_, _ = j.f.Write(append(b, '\n'))
+}
+
+func (j *journal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return nil
+	}
+	j.closed = true
+	return j.f.Close()
+}
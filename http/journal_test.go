@@ -0,0 +1,65 @@
+package http_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	httptest "github.com/hamba/testutils/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_WithJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	s := httptest.NewServer(t, httptest.WithJournal(path))
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodPost, "/test/path").Header("X-Test", "yes").ReturnsString(201, "created")
+	s.Fallback(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	res, err := http.Post(s.URL()+"/test/path", "text/plain", strings.NewReader("test body"))
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	doGet(t, s.URL()+"/other")
+
+	entries := readJournal(t, path)
+
+	require.Len(t, entries, 2)
+	assert.Equal(t, http.MethodPost, entries[0].Method)
+	assert.Equal(t, "/test/path", entries[0].URL)
+	assert.Equal(t, "test body", entries[0].Body)
+	assert.Equal(t, "text/plain", entries[0].Header.Get("Content-Type"))
+	assert.Equal(t, "POST /test/path", entries[0].Matched)
+	assert.Equal(t, 201, entries[0].Status)
+	assert.Equal(t, "yes", entries[0].ResponseHeader.Get("X-Test"))
+	assert.Equal(t, "created", entries[0].ResponseBody)
+	assert.Equal(t, "/other", entries[1].URL)
+	assert.Equal(t, "<none>", entries[1].Matched)
+	assert.Equal(t, http.StatusNotFound, entries[1].Status)
+}
+
+func readJournal(t *testing.T, path string) []httptest.JournalEntry {
+	t.Helper()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	var entries []httptest.JournalEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var entry httptest.JournalEntry
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, sc.Err())
+	return entries
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// pathPattern matches request paths segment by segment. Segments of the
+// form "{name}" match a single path segment, while a final "{name...}"
+// segment matches the remainder of the path. A final "{$}" segment only
+// matches the end of a path with a trailing slash.
+type pathPattern struct {
+	segments []string
+}
+
+// isPathPattern determines if the path contains pattern wildcards.
+func isPathPattern(path string) bool {
+	return strings.Contains(path, "{")
+}
+
+func newPathPattern(path string) *pathPattern {
+	return &pathPattern{segments: strings.Split(path, "/")}
+}
+
+// match returns the values captured from the escaped path, and if the path matched.
+func (p *pathPattern) match(path string) (map[string]string, bool) {
+	parts := strings.Split(path, "/")
+
+	vals := map[string]string{}
+	for i, seg := range p.segments {
+		if seg == "{$}" && i == len(p.segments)-1 {
+			if len(parts) != len(p.segments) || parts[i] != "" {
+				return nil, false
+			}
+			return vals, true
+		}
+
+		name, isWildcard := wildcardName(seg)
+		if isWildcard && strings.HasSuffix(name, "...") && i == len(p.segments)-1 {
+			if i >= len(parts) {
+				return nil, false
+			}
+			val, err := url.PathUnescape(strings.Join(parts[i:], "/"))
+			if err != nil {
+				return nil, false
+			}
+			vals[strings.TrimSuffix(name, "...")] = val
+			return vals, true
+		}
+
+		if i >= len(parts) {
+			return nil, false
+		}
+		val, err := url.PathUnescape(parts[i])
+		if err != nil {
+			return nil, false
+		}
+
+		switch {
+		case isWildcard:
+			if val == "" {
+				return nil, false
+			}
+			vals[name] = val
+		case seg != val:
+			return nil, false
+		}
+	}
+
+	if len(parts) != len(p.segments) {
+		return nil, false
+	}
+	return vals, true
+}
+
+func wildcardName(seg string) (string, bool) {
+	if len(seg) < 3 || seg[0] != '{' || seg[len(seg)-1] != '}' {
+		return "", false
+	}
+	return seg[1 : len(seg)-1], true
+}
+
+type pathMatchKey struct{}
+
+// pathMatch is the result of matching a path pattern or regular expression.
+type pathMatch struct {
+	values     map[string]string
+	submatches []string
+}
+
+func withPathMatch(req *http.Request, m pathMatch) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), pathMatchKey{}, m))
+}
+
+// PathValue returns the value captured by the named wildcard of the
+// expectation path pattern, or the named group of the expectation path
+// regular expression, matching the request. If there is no such value,
+// an empty string is returned.
+func PathValue(req *http.Request, name string) string {
+	m, _ := req.Context().Value(pathMatchKey{}).(pathMatch)
+	return m.values[name]
+}
+
+// PathSubmatches returns the submatches of the expectation path regular
+// expression matching the request, as returned by regexp.FindStringSubmatch.
+func PathSubmatches(req *http.Request) []string {
+	m, _ := req.Context().Value(pathMatchKey{}).(pathMatch)
+	return m.submatches
+}
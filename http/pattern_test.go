@@ -0,0 +1,184 @@
+package http_test
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	httptest "github.com/hamba/testutils/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_HandlesPathPatternExpectation(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    map[string]string
+	}{
+		{
+			name:    "segments",
+			pattern: "/users/{id}/orders/{oid}",
+			path:    "/users/123/orders/456",
+			want:    map[string]string{"id": "123", "oid": "456"},
+		},
+		{
+			name:    "escaped segment",
+			pattern: "/files/{name}",
+			path:    "/files/a%2Fb",
+			want:    map[string]string{"name": "a/b"},
+		},
+		{
+			name:    "remainder",
+			pattern: "/files/{path...}",
+			path:    "/files/a/b/c",
+			want:    map[string]string{"path": "a/b/c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(t)
+			t.Cleanup(s.Close)
+
+			var got map[string]string
+			s.On(http.MethodGet, tt.pattern).Handle(func(w http.ResponseWriter, r *http.Request) {
+				got = map[string]string{}
+				for k := range tt.want {
+					got[k] = httptest.PathValue(r, k)
+				}
+			})
+
+			doGet(t, s.URL()+tt.path)
+
+			assert.Equal(t, tt.want, got)
+			reqs := s.Requests()
+			require.Len(t, reqs, 1)
+			assert.Equal(t, tt.want, reqs[0].PathValues)
+		})
+	}
+}
+
+func TestServer_HandlesPathPatternEndExpectation(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{
+			name: "trailing slash",
+			path: "/a/",
+		},
+		{
+			name:    "segment",
+			path:    "/a/b",
+			wantErr: true,
+		},
+		{
+			name:    "no trailing slash",
+			path:    "/a",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockT := newMockT()
+
+			s := httptest.NewServer(mockT)
+			t.Cleanup(s.Close)
+			s.On(http.MethodGet, "/a/{$}")
+
+			doGet(t, s.URL()+tt.path)
+
+			if tt.wantErr {
+				mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything)
+			} else {
+				mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestServer_HandlesUnexpectedPathPatternRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{
+		{
+			name: "too many segments",
+			path: "/users/123/orders/456/items",
+		},
+		{
+			name: "too few segments",
+			path: "/users/123/orders",
+		},
+		{
+			name: "empty segment",
+			path: "/users//orders/456",
+		},
+		{
+			name: "different literal",
+			path: "/users/123/invoices/456",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockT := newMockT()
+			t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+			s := httptest.NewServer(mockT)
+			t.Cleanup(s.Close)
+			s.On(http.MethodGet, "/users/{id}/orders/{oid}")
+
+			doGet(t, s.URL()+tt.path)
+		})
+	}
+}
+
+func TestServer_HandlesRegexpExpectation(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	var (
+		sub []string
+		id  string
+	)
+	re := regexp.MustCompile(`^/users/(?P<id>[0-9a-f-]{36})/(orders|invoices)$`)
+	s.OnRegexp(http.MethodGet, re).Handle(func(w http.ResponseWriter, r *http.Request) {
+		sub = httptest.PathSubmatches(r)
+		id = httptest.PathValue(r, "id")
+	})
+
+	doGet(t, s.URL()+"/users/0b6ec6d4-5bd2-4d2b-b6a6-6f0a4f1e0e4b/orders")
+
+	want := []string{"/users/0b6ec6d4-5bd2-4d2b-b6a6-6f0a4f1e0e4b/orders", "0b6ec6d4-5bd2-4d2b-b6a6-6f0a4f1e0e4b", "orders"}
+	assert.Equal(t, want, sub)
+	assert.Equal(t, "0b6ec6d4-5bd2-4d2b-b6a6-6f0a4f1e0e4b", id)
+	s.AssertExpectations()
+}
+
+func TestServer_HandlesUnexpectedRegexpRequest(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.OnRegexp(http.MethodGet, regexp.MustCompile(`^/users/[0-9]+$`))
+
+	doGet(t, s.URL()+"/users/abc")
+}
+
+func TestServer_HandlesUnanchoredRegexpRequest(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.OnRegexp(http.MethodGet, regexp.MustCompile(`/users/[0-9]+`))
+
+	doGet(t, s.URL()+"/api/users/123/orders")
+}
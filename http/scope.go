@@ -0,0 +1,73 @@
+package http
+
+import (
+	"regexp"
+	"sync"
+)
+
+// Scope is a view of a server with expectations limited to a test.
+type Scope struct {
+	srv *Server
+	t   TestingT
+
+	mu     sync.Mutex
+	expect []*Expectation
+}
+
+// Scope returns a view of the server for the test. Expectations created
+// on the scope are asserted and removed from the server when the test
+// completes, allowing a server to be shared between subtests.
+func (s *Server) Scope(t TestingT) *Scope {
+	sc := &Scope{srv: s, t: t}
+	t.Cleanup(sc.close)
+
+	return sc
+}
+
+// On creates an expectation of a request on the server, scoped to the test.
+func (sc *Scope) On(method, path string) *Expectation {
+	return sc.add(sc.srv.On(method, path))
+}
+
+// NotOn creates an expectation of a request that must never be made on the
+// server, scoped to the test.
+func (sc *Scope) NotOn(method, path string) *Expectation {
+	return sc.add(sc.srv.NotOn(method, path))
+}
+
+// OnRegexp creates an expectation of a request on the server with a path
+// matching the regular expression, scoped to the test.
+func (sc *Scope) OnRegexp(method string, pathRe *regexp.Regexp) *Expectation {
+	return sc.add(sc.srv.OnRegexp(method, pathRe))
+}
+
+func (sc *Scope) add(exp *Expectation) *Expectation {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.expect = append(sc.expect, exp)
+	return exp
+}
+
+// AssertExpectations asserts all expectations of the scope have been met.
+func (sc *Scope) AssertExpectations() {
+	sc.mu.Lock()
+	exps := append([]*Expectation(nil), sc.expect...)
+	sc.mu.Unlock()
+
+	sc.srv.mu.Lock()
+	defer sc.srv.mu.Unlock()
+
+	assertExpectations(sc.t.Errorf, exps)
+}
+
+func (sc *Scope) close() {
+	sc.AssertExpectations()
+
+	sc.mu.Lock()
+	exps := sc.expect
+	sc.expect = nil
+	sc.mu.Unlock()
+
+	sc.srv.remove(exps)
+}
@@ -0,0 +1,75 @@
+package http_test
+
+import (
+	"net/http"
+	"testing"
+
+	httptest "github.com/hamba/testutils/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Scope(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodGet, "/health").Maybe()
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "first", path: "/a"},
+		{name: "second", path: "/b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := s.Scope(t)
+			sc.On(http.MethodGet, tt.path).ReturnsStatus(http.StatusAccepted)
+
+			res, err := http.Get(s.URL() + tt.path)
+			require.NoError(t, err)
+			_ = res.Body.Close()
+			doGet(t, s.URL()+"/health")
+
+			assert.Equal(t, http.StatusAccepted, res.StatusCode)
+		})
+	}
+
+	mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+	doGet(t, s.URL()+"/a")
+}
+
+func TestScope_AssertExpectations(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	mockT := newMockT()
+	sc := s.Scope(mockT)
+	sc.On(http.MethodGet, "/test/path")
+
+	sc.AssertExpectations()
+
+	mockT.AssertCalled(t, "Errorf", "Expected a call to %s but got none", mock.Anything)
+}
+
+func TestServer_Reset(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodGet, "/test/path")
+	doGet(t, s.URL()+"/test/path")
+
+	s.Reset()
+
+	assert.Empty(t, s.Requests())
+	s.AssertExpectations()
+	mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+	doGet(t, s.URL()+"/test/path")
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Sequencer records the order of requests across multiple mock servers.
+type Sequencer struct {
+	t TestingT
+
+	mu    sync.Mutex
+	calls []sequencedCall
+}
+
+type sequencedCall struct {
+	server string
+	method string
+	path   string
+}
+
+// NewSequencer creates a new sequencer.
+func NewSequencer(t TestingT) *Sequencer {
+	t.Helper()
+
+	return &Sequencer{t: t}
+}
+
+// Register records all requests made to the server under the given name.
+func (q *Sequencer) Register(name string, srv *Server) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.seqName = name
+	srv.seq = q
+}
+
+func (q *Sequencer) record(name string, req *http.Request) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.calls = append(q.calls, sequencedCall{
+		server: name,
+		method: req.Method,
+		path:   req.URL.Path,
+	})
+}
+
+// AssertCalledBefore asserts the first request to server first
+// was made before the first request to server second.
+func (q *Sequencer) AssertCalledBefore(first, second string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	firstIdx, secondIdx := -1, -1
+	for i, call := range q.calls {
+		if call.server == first && firstIdx == -1 {
+			firstIdx = i
+		}
+		if call.server == second && secondIdx == -1 {
+			secondIdx = i
+		}
+	}
+
+	switch {
+	case firstIdx == -1:
+		q.t.Errorf("Expected a call to %s but got none", first)
+	case secondIdx == -1:
+		q.t.Errorf("Expected a call to %s but got none", second)
+	case firstIdx > secondIdx:
+		q.t.Errorf("Expected %s to be called before %s but got %s", first, second, q.sequence())
+	}
+}
+
+// AssertOrder asserts the servers were called in the given order.
+// Other calls are allowed between the given servers.
+func (q *Sequencer) AssertOrder(names ...string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := 0
+	for _, call := range q.calls {
+		if i < len(names) && call.server == names[i] {
+			i++
+		}
+	}
+	if i < len(names) {
+		q.t.Errorf("Expected calls in order %s but got %s", strings.Join(names, ", "), q.sequence())
+	}
+}
+
+func (q *Sequencer) sequence() string {
+	seq := make([]string, 0, len(q.calls))
+	for _, call := range q.calls {
+		seq = append(seq, call.server+" "+call.method+" "+call.path)
+	}
+	return strings.Join(seq, ", ")
+}
@@ -0,0 +1,115 @@
+package http_test
+
+import (
+	"net/http"
+	"testing"
+
+	httptest "github.com/hamba/testutils/http"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequencer_AssertCalledBefore(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything) })
+
+	auth, billing := newSequencedServers(t, mockT)
+	seq := httptest.NewSequencer(mockT)
+	seq.Register("auth", auth)
+	seq.Register("billing", billing)
+
+	doGet(t, auth.URL()+"/login")
+	doGet(t, billing.URL()+"/charge")
+
+	seq.AssertCalledBefore("auth", "billing")
+	seq.AssertOrder("auth", "billing")
+}
+
+func TestSequencer_AssertCalledBeforeWrongOrder(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() {
+		mockT.AssertCalled(t, "Errorf", "Expected %s to be called before %s but got %s", mock.Anything)
+	})
+
+	auth, billing := newSequencedServers(t, mockT)
+	seq := httptest.NewSequencer(mockT)
+	seq.Register("auth", auth)
+	seq.Register("billing", billing)
+
+	doGet(t, billing.URL()+"/charge")
+	doGet(t, auth.URL()+"/login")
+
+	seq.AssertCalledBefore("auth", "billing")
+}
+
+func TestSequencer_AssertCalledBeforeNotCalled(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Expected a call to %s but got none", mock.Anything) })
+
+	auth, billing := newSequencedServers(t, mockT)
+	seq := httptest.NewSequencer(mockT)
+	seq.Register("auth", auth)
+	seq.Register("billing", billing)
+
+	doGet(t, auth.URL()+"/login")
+
+	seq.AssertCalledBefore("auth", "billing")
+}
+
+func TestSequencer_AssertOrderWrongOrder(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Expected calls in order %s but got %s", mock.Anything) })
+
+	auth, billing := newSequencedServers(t, mockT)
+	seq := httptest.NewSequencer(mockT)
+	seq.Register("auth", auth)
+	seq.Register("billing", billing)
+
+	doGet(t, auth.URL()+"/login")
+	doGet(t, billing.URL()+"/charge")
+	doGet(t, auth.URL()+"/logout")
+
+	seq.AssertOrder("billing", "auth", "billing")
+}
+
+func TestSequencer_RegisterDuringRequests(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything) })
+
+	auth, _ := newSequencedServers(t, mockT)
+	seq := httptest.NewSequencer(mockT)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		seq.Register("auth", auth)
+	}()
+	doConcurrentGets(t, auth.URL()+"/login", 20)
+	<-done
+
+	doGet(t, auth.URL()+"/logout")
+	seq.AssertOrder("auth")
+}
+
+func newSequencedServers(t *testing.T, mockT httptest.TestingT) (*httptest.Server, *httptest.Server) {
+	t.Helper()
+
+	auth := httptest.NewServer(mockT)
+	t.Cleanup(auth.Close)
+	auth.On(http.MethodGet, httptest.Anything)
+
+	billing := httptest.NewServer(mockT)
+	t.Cleanup(billing.Close)
+	billing.On(http.MethodGet, httptest.Anything)
+
+	return auth, billing
+}
+
+func doGet(t *testing.T, url string) {
+	t.Helper()
+
+	res, err := http.Get(url)
+	require.NoError(t, err)
+	_ = res.Body.Close()
+}
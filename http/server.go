@@ -13,7 +13,6 @@ Example Server Usage:
 	func TestSomething(t *testing.T) {
 		s := httptest.NewServer(t)
 		s.On(http.MethodGet, "/your/endpoint").Times(2).ReturnsString(http.StatusOK, "some return")
-		defer s.Close()
 
 		// Call the server
 
@@ -23,13 +22,33 @@ Example Server Usage:
 package http
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
-	"testing"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
 
 	"github.com/ryanuber/go-glob"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 const (
@@ -39,118 +58,1777 @@ const (
 
 // Expectation represents an http request expectation.
 type Expectation struct {
-	method string
-	path   string
-	qry    *url.Values
+	srv *Server
 
-	fn http.HandlerFunc
+	method  string
+	path    string
+	pattern *pathPattern
+	pathRe  *regexp.Regexp
+	qry     *url.Values
 
-	headers []string
-	body    []byte
-	status  int
+	matchHeaders   []string
+	matchCookies   []string
+	withoutHeaders []string
+	exactHeaders   http.Header
+	clientCertCN   string
+	bodyMatchers   []bodyMatcher
+	matchFns       []func(*http.Request) bool
 
-	times  int
-	called int
+	reply
+
+	notifier *notifier
+	reader   io.Reader
+
+	minCalls int
+	maxCalls int
+	minSet   bool
+	never    bool
+	calls    int
+	requests []Request
+
+	inflight int32
+
+	after []*Expectation
+}
+
+// reply is how an expectation responds to matched requests.
+type reply struct {
+	discardBody bool
+	bodyStream  func(io.Reader) error
+
+	fn  http.HandlerFunc
+	run func(*http.Request)
+
+	dropConn bool
+	hang     bool
+
+	headerDelay time.Duration
+	bodyDelay   time.Duration
+
+	headers     []string
+	cookies     []*http.Cookie
+	contentType string
+	body        []byte
+	bodyErr     error
+	status      int
+	returnsFn   func(*http.Request) (int, []byte)
+
+	readerLen int64
+	hasReader bool
+
+	tmplPath string
+	tmplData interface{}
+
+	seq []Response
+
+	negotiate map[string]Response
+
+	maxConcurrent int32
+}
+
+func newExpectation(srv *Server, method, path string) *Expectation {
+	return &Expectation{
+		srv:      srv,
+		method:   method,
+		path:     path,
+		minCalls: 1,
+		maxCalls: -1,
+		reply:    reply{status: 200},
+	}
+}
+
+// snapshot returns the reply of the expectation.
+func (e *Expectation) snapshot() reply {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	return e.reply
+}
+
+// Times sets the number of times the request can be made.
+func (e *Expectation) Times(times int) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.minCalls = times
+	e.maxCalls = times
+	e.minSet = true
+
+	return e
+}
+
+// Once sets the request to be made exactly once.
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+// Twice sets the request to be made exactly twice.
+func (e *Expectation) Twice() *Expectation {
+	return e.Times(2)
+}
+
+// AtLeast sets the minimum number of times the request must be made.
+func (e *Expectation) AtLeast(times int) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.minCalls = times
+	e.minSet = true
+
+	return e
+}
+
+// AtMost sets the maximum number of times the request can be made.
+// Unless a minimum is set, the request is not required to be made.
+func (e *Expectation) AtMost(times int) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.maxCalls = times
+	if !e.minSet {
+		e.minCalls = 0
+	}
+
+	return e
+}
+
+// Maybe allows the request to be made without requiring it.
+// The expectation never fails AssertExpectations.
+func (e *Expectation) Maybe() *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.minCalls = 0
+	e.minSet = true
+
+	return e
+}
+
+// Never sets the request to never be made. Any matching request fails the test,
+// taking precedence over all other expectations.
+func (e *Expectation) Never() *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.never = true
+	e.minCalls = 0
+	e.minSet = true
+
+	return e
+}
+
+// MaxConcurrent sets the maximum number of matching requests that may be in flight
+// at the same time. Exceeding the limit fails the test.
+func (e *Expectation) MaxConcurrent(n int) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.maxConcurrent = int32(n)
+
+	return e
+}
+
+// After requires the other expectations to be satisfied before this
+// expectation can be matched. Requests arriving out of order fail the test.
+func (e *Expectation) After(others ...*Expectation) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.after = append(e.after, others...)
+
+	return e
+}
+
+// isNever determines if the expectation must never be matched.
+func (e *Expectation) isNever() bool {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	return e.never
+}
+
+// satisfied determines if the expectation has been called the expected number of times.
+func (e *Expectation) satisfied() bool {
+	return e.calls >= e.minCalls
+}
+
+// DelayHeader sets the delay before the response headers are written,
+// allowing the client time to first byte timeouts to be tested.
+func (e *Expectation) DelayHeader(d time.Duration) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.headerDelay = d
+
+	return e
+}
+
+// DelayBody sets the delay between writing the response headers and the body,
+// allowing the client body read timeouts to be tested.
+func (e *Expectation) DelayBody(d time.Duration) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.bodyDelay = d
+
+	return e
+}
+
+// Header sets the HTTP headers that should be returned.
+func (e *Expectation) Header(k, v string) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.headers = append(e.headers, k, v)
+
+	return e
+}
+
+// MatchHeader sets a header the request must have. The value
+// can contain wildcards or be Anything to only require the header be present.
+func (e *Expectation) MatchHeader(k, v string) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.matchHeaders = append(e.matchHeaders, k, v)
+
+	return e
+}
+
+// MatchCookie sets a cookie the request must have. The value
+// can contain wildcards or be Anything to only require the cookie be present.
+func (e *Expectation) MatchCookie(name, value string) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.matchCookies = append(e.matchCookies, name, value)
+
+	return e
+}
+
+// SetCookie sets a cookie that should be returned.
+func (e *Expectation) SetCookie(c *http.Cookie) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.cookies = append(e.cookies, c)
+
+	return e
+}
+
+// WithoutHeader sets a header the request must not have.
+func (e *Expectation) WithoutHeader(k string) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.withoutHeaders = append(e.withoutHeaders, k)
+
+	return e
+}
+
+// WithExactHeaders sets the exact headers the request must have, with no
+// others present. Headers added by the client transport, such as User-Agent
+// and Accept-Encoding, must be included.
+func (e *Expectation) WithExactHeaders(h http.Header) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.exactHeaders = http.Header{}
+	for k, v := range h {
+		e.exactHeaders[http.CanonicalHeaderKey(k)] = v
+	}
+
+	return e
+}
+
+// MatchClientCertCN sets the common name of the certificate the client must present.
+func (e *Expectation) MatchClientCertCN(cn string) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.clientCertCN = cn
+
+	return e
+}
+
+// MatchFn sets a function the request must satisfy. The request body given
+// to the function is a copy of the body, truncated to 1MiB.
+func (e *Expectation) MatchFn(fn func(*http.Request) bool) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.matchFns = append(e.matchFns, fn)
+
+	return e
+}
+
+// MatchBodyPrefix sets a matcher on at most the first n bytes of the request body.
+// Only the prefix is buffered, the remainder of the body is streamed to the response
+// handler untouched, allowing large or streaming request bodies to be matched.
+func (e *Expectation) MatchBodyPrefix(n int64, fn func(prefix []byte) bool) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.bodyMatchers = append(e.bodyMatchers, bodyMatcher{limit: n, fn: fn})
+
+	return e
+}
+
+// maxJSONBodySize is the maximum request body size matched as JSON.
+const maxJSONBodySize = 10 << 20
+
+// JSONBody sets the JSON the request body must be semantically equal to, ignoring
+// key order and whitespace. The value is marshalled to JSON, a json.RawMessage can
+// be used to match against a JSON string. If the value cannot be marshalled,
+// the test fails and the expectation never matches.
+func (e *Expectation) JSONBody(v interface{}) *Expectation {
+	want, err := normalizeJSON(v)
+	if err != nil {
+		e.srv.t.Errorf("Unable to marshal JSON body for %s: %v", e.describe(), err)
+	}
+	return e.MatchBodyPrefix(maxJSONBodySize, func(body []byte) bool {
+		if err != nil {
+			return false
+		}
+
+		var got interface{}
+		if err := json.Unmarshal(body, &got); err != nil {
+			return false
+		}
+		return reflect.DeepEqual(want, got)
+	})
+}
+
+func normalizeJSON(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var norm interface{}
+	err = json.Unmarshal(b, &norm)
+	return norm, err
+}
+
+// WithBodyStream sets a function validating the request body as it arrives,
+// failing the test if an error is returned. The body is consumed by the
+// function before responding.
+//
+// To not delay streamed bodies, while the server has such an expectation
+// request bodies are only buffered and recorded as far as needed by body matchers.
+func (e *Expectation) WithBodyStream(fn func(io.Reader) error) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.bodyStream = fn
+
+	return e
+}
+
+// DiscardBody discards the remainder of the request body before responding.
+func (e *Expectation) DiscardBody() *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.discardBody = true
+
+	return e
+}
+
+// Run sets a function to be run on each matched request before the response
+// is written. The request body given to the function is a copy of the body,
+// truncated to 1MiB.
+func (e *Expectation) Run(fn func(*http.Request)) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.run = fn
+
+	return e
+}
+
+// Notify returns a channel on which each matched request is delivered.
+// The request body is a copy of the body, truncated to 1MiB. Requests are
+// queued until received, and the channel is closed when the server is closed.
+func (e *Expectation) Notify() <-chan *http.Request {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	if e.notifier == nil {
+		e.notifier = newNotifier(e.srv.done)
+	}
+	return e.notifier.out
+}
+
+// Handle sets the HTTP handler function to be run on the request.
+func (e *Expectation) Handle(fn http.HandlerFunc) {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.resetReply()
+	e.fn = fn
+}
+
+// DropsConnection closes the client connection without responding.
+func (e *Expectation) DropsConnection() {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.dropConn = true
+}
+
+// Hangs never responds to the request. The request is held until the
+// client gives up or the server is closed.
+func (e *Expectation) Hangs() {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.hang = true
+}
+
+// ReturnsStatus sets the HTTP stats code to return.
+func (e *Expectation) ReturnsStatus(status int) {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.resetReply()
+	e.body = []byte{}
+	e.status = status
+}
+
+// Returns sets the HTTP stats and body bytes to return.
+func (e *Expectation) Returns(status int, body []byte) {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.resetReply()
+	e.body = body
+	e.status = status
+}
+
+// ReturnsString sets the HTTP stats and body string to return.
+func (e *Expectation) ReturnsString(status int, body string) {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.resetReply()
+	e.body = []byte(body)
+	e.status = status
+}
+
+// ReturnsFn sets a function computing the HTTP status and body to return
+// from the request.
+func (e *Expectation) ReturnsFn(fn func(*http.Request) (int, []byte)) {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.resetReply()
+	e.returnsFn = fn
+}
+
+// ReturnsReader sets the HTTP status and a reader streamed as the body to return,
+// avoiding large or generated bodies being held in memory. A negative content
+// length sends the body chunked. The reader is only consumed by the first
+// matching request, later requests receive an empty body.
+func (e *Expectation) ReturnsReader(status int, r io.Reader, contentLength int64) {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.resetReply()
+	e.reader = r
+	e.readerLen = contentLength
+	e.hasReader = true
+	e.status = status
+}
+
+// resetReply clears the response set by any previous reply setter,
+// so the last setter called wins. The lock must be held.
+func (e *Expectation) resetReply() {
+	e.fn = nil
+	e.returnsFn = nil
+	e.tmplPath, e.tmplData = "", nil
+	e.seq = nil
+	e.negotiate = nil
+	e.body, e.bodyErr = nil, nil
+	e.contentType = ""
+	e.reader, e.readerLen, e.hasReader = nil, 0, false
+}
+
+// takeReader returns the body reader, if it has not yet been consumed.
+func (e *Expectation) takeReader() (io.Reader, int64) {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	r := e.reader
+	e.reader = nil
+	return r, e.readerLen
+}
+
+// Response is an HTTP response returned by an expectation.
+type Response struct {
+	Status int
+	Body   []byte
+}
+
+// ReturnsSeq sets the HTTP status and body bytes to return on the first call.
+// Responses for later calls are added with ThenReturns.
+func (e *Expectation) ReturnsSeq(status int, body []byte) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.resetReply()
+	e.seq = []Response{{Status: status, Body: body}}
+
+	return e
+}
+
+// ThenReturns adds the HTTP status and body bytes to return on the next call
+// in the sequence. The last response in the sequence is returned for all
+// further calls.
+func (e *Expectation) ThenReturns(status int, body []byte) *Expectation {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.seq = append(e.seq, Response{Status: status, Body: body})
+
+	return e
+}
+
+// Negotiates sets the responses to return by content type. The response is
+// selected using the request Accept header, returning 406 Not Acceptable
+// if no content type is acceptable.
+func (e *Expectation) Negotiates(resps map[string]Response) {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.resetReply()
+	e.negotiate = resps
+}
+
+// negotiate selects the content type best matching the accept header values.
+func negotiate(accept []string, resps map[string]Response) (string, bool) {
+	types := make([]string, 0, len(resps))
+	for typ := range resps {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	if len(accept) == 0 {
+		accept = []string{"*/*"}
+	}
+
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, v := range accept {
+		for _, rng := range strings.Split(v, ",") {
+			mediaType, q := parseAcceptRange(rng)
+			if q <= bestQ {
+				continue
+			}
+			for _, typ := range types {
+				if glob.Glob(mediaType, typ) {
+					best, bestQ = typ, q
+					break
+				}
+			}
+		}
+	}
+	return best, best != ""
+}
+
+func parseAcceptRange(rng string) (string, float64) {
+	parts := strings.Split(rng, ";")
+	mediaType := strings.ToLower(strings.TrimSpace(parts[0]))
+
+	q := 1.0
+	for _, param := range parts[1:] {
+		k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || strings.ToLower(k) != "q" {
+			continue
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			q = f
+		}
+	}
+	return mediaType, q
+}
+
+// ReturnsJSON sets the HTTP status and the value to return marshalled as JSON.
+// The Content-Type is set to application/json, unless set with Header.
+func (e *Expectation) ReturnsJSON(status int, v interface{}) {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.resetReply()
+	e.body, e.bodyErr = json.Marshal(v)
+	e.status = status
+	e.contentType = "application/json"
+}
+
+// TemplateData is the data a response template is rendered with.
+type TemplateData struct {
+	// Data is the data given to the expectation.
+	Data interface{}
+	// Request is the request being responded to.
+	Request *http.Request
+}
+
+// ReturnsTemplateFile sets the HTTP status and a text template file used to render the body.
+// The template is rendered with TemplateData on each request.
+func (e *Expectation) ReturnsTemplateFile(status int, path string, data interface{}) {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	e.resetReply()
+	e.tmplPath = path
+	e.tmplData = data
+	e.status = status
+}
+
+func (r reply) renderTemplate(req *http.Request) ([]byte, error) {
+	tmpl, err := template.New(filepath.Base(r.tmplPath)).ParseFiles(r.tmplPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, TemplateData{Data: r.tmplData, Request: req}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (e *Expectation) describe() string {
+	var call string
+	if e.method != Anything {
+		call = e.method
+	}
+	if e.path != Anything {
+		if call != "" {
+			call += " "
+		}
+		call += e.path
+	}
+	if e.qry != nil {
+		if call != "" || e.path == Anything {
+			call += " "
+		}
+		call += e.qry.Encode()
+	}
+	return call
+}
+
+// pathMatch returns the values captured by the path pattern or regular expression.
+func (e *Expectation) pathMatch(req *http.Request) pathMatch {
+	switch {
+	case e.pattern != nil:
+		vals, _ := e.pattern.match(req.URL.EscapedPath())
+		return pathMatch{values: vals}
+	case e.pathRe != nil:
+		sub := e.pathRe.FindStringSubmatch(req.URL.Path)
+		vals := map[string]string{}
+		for i, name := range e.pathRe.SubexpNames() {
+			if name != "" && i < len(sub) {
+				vals[name] = sub[i]
+			}
+		}
+		return pathMatch{values: vals, submatches: sub}
+	default:
+		return pathMatch{}
+	}
+}
+
+// Wait waits until the expectation has been matched at least n times,
+// failing the test if it is not matched within the timeout.
+func (e *Expectation) Wait(n int, timeout time.Duration) {
+	var got int
+	ok := e.srv.waitFor(timeout, func() bool {
+		got = e.calls
+		return got >= n
+	})
+	if !ok {
+		e.srv.t.Errorf("Expected %d calls to %s within %s but got %d", n, e.describe(), timeout, got)
+	}
+}
+
+// CallCount returns the number of times the expectation has been matched.
+func (e *Expectation) CallCount() int {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	return e.calls
+}
+
+// Requests returns the requests that matched the expectation.
+func (e *Expectation) Requests() []Request {
+	e.srv.mu.Lock()
+	defer e.srv.mu.Unlock()
+
+	return append([]Request(nil), e.requests...)
+}
+
+// maxRecordedBodySize is the maximum number of body bytes recorded for a request.
+const maxRecordedBodySize = 1 << 20
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	// Body is a copy of the request body, truncated to 1MiB.
+	// Gzip encoded bodies are decoded.
+	Body []byte
+	// RawBody is a copy of the request body as received, truncated to 1MiB.
+	RawBody []byte
+	// Deadline is the remaining deadline propagated by the client, or zero.
+	Deadline time.Duration
+	// PathValues are the values captured by the path pattern or regular
+	// expression of the matched expectation.
+	PathValues map[string]string
+}
+
+func newRequest(req *http.Request, prefix, raw []byte, deadlineHeader string) Request {
+	u := *req.URL
+
+	return Request{
+		Method:   req.Method,
+		URL:      &u,
+		Header:   req.Header.Clone(),
+		Body:     truncateBody(prefix),
+		RawBody:  truncateBody(raw),
+		Deadline: parseDeadline(req.Header.Get(deadlineHeader)),
+	}
+}
+
+func truncateBody(b []byte) []byte {
+	if len(b) > maxRecordedBodySize {
+		b = b[:maxRecordedBodySize]
+	}
+	return append([]byte(nil), b...)
+}
+
+func parseDeadline(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Duration(ms) * time.Millisecond
+	}
+	d, _ := time.ParseDuration(v)
+	return d
+}
+
+// TestingT represents a partial *testing.T, allowing the server to be
+// used from benchmarks, fuzz tests and custom test harnesses.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Cleanup(fn func())
+}
+
+type tFatal interface {
+	Fatalf(format string, args ...interface{})
+}
+
+type tLogger interface {
+	Logf(format string, args ...interface{})
+}
+
+// fatalf fails the test, stopping it if supported by t.
+func fatalf(t TestingT, format string, args ...interface{}) {
+	t.Helper()
+
+	if f, ok := t.(tFatal); ok {
+		f.Fatalf(format, args...)
+		return
+	}
+	t.Errorf(format, args...)
+}
+
+// logf logs to the test, if supported by t.
+func logf(t TestingT, format string, args ...interface{}) {
+	if l, ok := t.(tLogger); ok {
+		l.Logf(format, args...)
+	}
+}
+
+// Server represents a mock http server.
+type Server struct {
+	t   TestingT
+	srv *httptest.Server
+
+	unixPath   string
+	noListener bool
+
+	seq     *Sequencer
+	seqName string
+
+	accessLog      bool
+	requestLogging bool
+	journal        *journal
+	deadlineHeader string
+
+	continueDelay  time.Duration
+	continueStatus int
+
+	unmatched UnmatchedMode
+
+	autoAssert  bool
+	noAutoClose bool
+
+	numRequests int64
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu        sync.Mutex
+	clientCAs *x509.CertPool
+	expect    []*Expectation
+	requests  []Request
+	inOrder   bool
+	last      *Expectation
+	fallback  http.HandlerFunc
+	headers   http.Header
+	changed   chan struct{}
+}
+
+// OptFunc configures a Server.
+type OptFunc func(*Server)
+
+// WithReadTimeout sets the maximum duration for reading an entire request.
+func WithReadTimeout(d time.Duration) OptFunc {
+	return func(s *Server) {
+		s.srv.Config.ReadTimeout = d
+	}
+}
+
+// WithWriteTimeout sets the maximum duration before timing out writes of a response.
+func WithWriteTimeout(d time.Duration) OptFunc {
+	return func(s *Server) {
+		s.srv.Config.WriteTimeout = d
+	}
+}
+
+// WithAccessLog logs a line for each request made to the server.
+func WithAccessLog() OptFunc {
+	return func(s *Server) {
+		s.accessLog = true
+	}
+}
+
+// WithContinueDelay delays the interim 100 Continue response to requests
+// with an "Expect: 100-continue" header.
+func WithContinueDelay(d time.Duration) OptFunc {
+	return func(s *Server) {
+		s.continueDelay = d
+	}
+}
+
+// WithContinueRefused refuses requests with an "Expect: 100-continue" header,
+// responding with the given status before the request body is sent.
+func WithContinueRefused(status int) OptFunc {
+	return func(s *Server) {
+		s.continueStatus = status
+	}
+}
+
+// WithPort binds the server to the given fixed loopback port.
+func WithPort(port int) OptFunc {
+	return func(s *Server) {
+		l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if err != nil {
+			fatalf(s.t, "Unable to listen on port %d: %v", port, err)
+			return
+		}
+		s.Listener(l)
+	}
+}
+
+// WithHTTP2 enables HTTP/2 on the server. TLS servers negotiate h2,
+// plain servers accept h2c with prior knowledge or upgrade.
+func WithHTTP2() OptFunc {
+	return func(s *Server) {
+		s.srv.EnableHTTP2 = true
+		s.srv.Config.Handler = h2c.NewHandler(s.srv.Config.Handler, &http2.Server{})
+	}
+}
+
+// WithRequestLogging logs each request made to the server, with its headers,
+// body and the matched expectation.
+func WithRequestLogging() OptFunc {
+	return func(s *Server) {
+		s.requestLogging = true
+	}
+}
+
+// WithJournal appends a JSON line for each request made to the server
+// and its response to the file at path. Each line is written as soon
+// as the response is complete, so the journal survives a crash.
+func WithJournal(path string) OptFunc {
+	return func(s *Server) {
+		j, err := openJournal(path)
+		if err != nil {
+			fatalf(s.t, "Unable to open journal %s: %v", path, err)
+			return
+		}
+		s.journal = j
+	}
+}
+
+// UnmatchedMode is the behaviour of the server on requests that do not
+// match any expectation.
+type UnmatchedMode int
+
+// Unmatched request modes.
+const (
+	// UnmatchedFail fails the test.
+	UnmatchedFail UnmatchedMode = iota
+	// UnmatchedNotFound responds with 404 Not Found.
+	UnmatchedNotFound
+	// UnmatchedNotImplemented responds with 501 Not Implemented.
+	UnmatchedNotImplemented
+	// UnmatchedPanic panics in the request handler. The panic is
+	// recovered by the http server, which closes the connection.
+	UnmatchedPanic
+)
+
+// WithUnmatched sets the behaviour of the server on requests that do not
+// match any expectation. By default the test is failed.
+func WithUnmatched(mode UnmatchedMode) OptFunc {
+	return func(s *Server) {
+		s.unmatched = mode
+	}
+}
+
+// DefaultDeadlineHeader is the default header clients propagate their remaining deadline in.
+const DefaultDeadlineHeader = "X-Request-Timeout"
+
+// WithDeadlineHeader sets the header clients propagate their remaining deadline in.
+// The header value is either a duration, e.g. "1.5s", or a number of milliseconds.
+func WithDeadlineHeader(name string) OptFunc {
+	return func(s *Server) {
+		s.deadlineHeader = name
+	}
+}
+
+// WithAutoAssert asserts the server expectations when the test completes.
+func WithAutoAssert() OptFunc {
+	return func(s *Server) {
+		s.autoAssert = true
+	}
+}
+
+// WithoutAutoClose disables closing the server when the test completes,
+// for tests that manage the server lifecycle themselves.
+func WithoutAutoClose() OptFunc {
+	return func(s *Server) {
+		s.noAutoClose = true
+	}
+}
+
+// NewServer creates a new mock http server.
+func NewServer(t TestingT, opts ...OptFunc) *Server {
+	t.Helper()
+
+	srv := newServer(t, opts)
+	srv.srv.Start()
+
+	return srv
+}
+
+// NewTLSServer creates a new mock https server.
+func NewTLSServer(t TestingT, opts ...OptFunc) *Server {
+	t.Helper()
+
+	srv := newServer(t, opts)
+	srv.StartTLS()
+
+	return srv
+}
+
+// unixURL is the url of servers listening on a unix socket.
+const unixURL = "http://unix"
+
+// NewUnixServer creates a new mock http server listening on the unix socket path.
+// Requests are made with the server Client against the server URL.
+func NewUnixServer(t TestingT, socketPath string, opts ...OptFunc) *Server {
+	t.Helper()
+
+	srv := newServer(t, opts)
+
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		fatalf(t, "Unable to listen on socket %s: %v", socketPath, err)
+		return nil
+	}
+	srv.Listener(l)
+	srv.unixPath = socketPath
+	srv.srv.Start()
+
+	tr := srv.srv.Client().Transport.(*http.Transport)
+	tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socketPath)
+	}
+
+	return srv
+}
+
+// NewUnstartedServer creates a new mock http server that is not started.
+// The server is started with Start or StartTLS.
+func NewUnstartedServer(t TestingT, opts ...OptFunc) *Server {
+	t.Helper()
+
+	return newServer(t, opts)
+}
+
+func newServer(t TestingT, opts []OptFunc) *Server {
+	srv := &Server{
+		t:              t,
+		deadlineHeader: DefaultDeadlineHeader,
+		done:           make(chan struct{}),
+	}
+	srv.srv = httptest.NewUnstartedServer(http.HandlerFunc(srv.handler))
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+	t.Cleanup(srv.cleanup)
+
+	return srv
+}
+
+// cleanup asserts the expectations and closes the server, as configured,
+// when the test completes.
+func (s *Server) cleanup() {
+	if s.autoAssert {
+		s.AssertExpectations()
+	}
+	if !s.noAutoClose {
+		s.Close()
+	}
+}
+
+// Listener sets the listener the server accepts connections on.
+// It must be called before the server is started.
+func (s *Server) Listener(l net.Listener) {
+	if s.srv.Listener != nil {
+		_ = s.srv.Listener.Close()
+	}
+	s.srv.Listener = l
+}
+
+// Start starts an unstarted server.
+func (s *Server) Start() {
+	s.srv.Start()
+}
+
+// StartTLS starts an unstarted server using TLS.
+func (s *Server) StartTLS() {
+	if s.srv.TLS == nil {
+		s.srv.TLS = &tls.Config{}
+	}
+	s.srv.TLS.GetConfigForClient = s.tlsConfigForClient
+	s.srv.StartTLS()
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	if s.srv.Listener == nil {
+		return ""
+	}
+	return s.srv.Listener.Addr().String()
+}
+
+// URL returns the url of the mock server.
+func (s *Server) URL() string {
+	if s.unixPath != "" {
+		return unixURL
+	}
+	return s.srv.URL
+}
+
+func (s *Server) tlsConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	s.mu.Lock()
+	pool := s.clientCAs
+	s.mu.Unlock()
+
+	if pool == nil {
+		return nil, nil
+	}
+
+	cfg := s.srv.TLS.Clone()
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	cfg.ClientCAs = pool
+	return cfg, nil
+}
+
+// RequireClientCert requires clients of a TLS server to present a
+// certificate signed by one of the given certificate authorities.
+func (s *Server) RequireClientCert(ca *x509.CertPool) {
+	if s.srv.TLS == nil {
+		s.t.Errorf("Client certificates require a TLS server")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clientCAs = ca
+}
+
+// Client returns an http client configured for making requests to the server.
+// For TLS servers the client trusts the server certificate.
+func (s *Server) Client() *http.Client {
+	if s.noListener {
+		return &http.Client{Transport: s.Transport()}
+	}
+	return s.srv.Client()
+}
+
+func (s *Server) handler(w http.ResponseWriter, req *http.Request) {
+	atomic.AddInt64(&s.numRequests, 1)
+
+	s.mu.Lock()
+	seq, seqName := s.seq, s.seqName
+	for k, v := range s.headers {
+		w.Header()[k] = append([]string(nil), v...)
+	}
+	s.mu.Unlock()
+
+	if seq != nil {
+		seq.record(seqName, req)
+	}
+
+	if !s.accessLog && s.journal == nil {
+		s.serve(w, req)
+		return
+	}
+
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK, keepBody: s.journal != nil}
+	exp, r := s.serve(rec, req)
+	dur := time.Since(start)
+
+	matched := "<none>"
+	if exp != nil {
+		matched = exp.describe()
+	}
+	if s.accessLog {
+		status := strconv.Itoa(rec.status)
+		if rec.dropped {
+			status = "dropped"
+		}
+		logf(s.t, "%s %s matched=%q status=%s duration=%s", req.Method, req.URL.String(), matched, status, dur)
+	}
+	if s.journal != nil {
+		s.journal.write(start, r, matched, rec, dur)
+	}
+}
+
+// serve responds to the request, returning the matched expectation if any
+// and the recorded request.
+func (s *Server) serve(w http.ResponseWriter, req *http.Request) (exp *Expectation, rec Request) {
+	if strings.EqualFold(req.Header.Get("Expect"), "100-continue") {
+		if s.continueStatus != 0 {
+			s.mu.Lock()
+			rec = newRequest(req, nil, nil, s.deadlineHeader)
+			s.requests = append(s.requests, rec)
+			s.notifyChanged()
+			s.mu.Unlock()
+
+			w.WriteHeader(s.continueStatus)
+			return nil, rec
+		}
+		sleepCtx(req, s.continueDelay)
+	}
+
+	limit := s.bodyPrefixLimit()
+	raw := readBodyPrefix(req, limit)
+	prefix := decodeBodyPrefix(req, raw, limit)
+	rec = newRequest(req, prefix, raw, s.deadlineHeader)
+	exp, call, blockedBy := s.match(req, prefix, rec)
+	if s.requestLogging {
+		s.logRequest(rec, exp, blockedBy)
+	}
+	switch {
+	case blockedBy != nil:
+		s.t.Errorf("Expected a call to %s before %s %s", blockedBy.describe(), req.Method, req.URL.String())
+		return nil, rec
+	case exp == nil:
+		s.mu.Lock()
+		fallback := s.fallback
+		s.mu.Unlock()
+
+		switch {
+		case fallback != nil:
+			fallback(w, req)
+		case s.unmatched == UnmatchedNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case s.unmatched == UnmatchedNotImplemented:
+			w.WriteHeader(http.StatusNotImplemented)
+		case s.unmatched == UnmatchedPanic:
+			panic(fmt.Sprintf("httptest: unexpected call to %s %s", req.Method, req.URL.String()))
+		default:
+			s.t.Errorf("Unexpected call to %s %s", req.Method, req.URL.String())
+		}
+		return nil, rec
+	case exp.isNever():
+		s.t.Errorf("Expected no calls to %s but got %s %s", exp.describe(), req.Method, req.URL.String())
+		w.WriteHeader(http.StatusInternalServerError)
+		return exp, rec
+	}
+
+	resp := exp.snapshot()
+
+	if inflight := atomic.AddInt32(&exp.inflight, 1); resp.maxConcurrent > 0 && inflight > resp.maxConcurrent {
+		s.t.Errorf("Expected at most %d concurrent calls to %s but got %d", resp.maxConcurrent, exp.describe(), inflight)
+	}
+	defer atomic.AddInt32(&exp.inflight, -1)
+
+	if exp.pattern != nil || exp.pathRe != nil {
+		req = withPathMatch(req, exp.pathMatch(req))
+	}
+
+	if resp.run != nil {
+		r := req.Clone(req.Context())
+		r.Body = io.NopCloser(bytes.NewReader(truncateBody(prefix)))
+		resp.run(r)
+	}
+
+	s.mu.Lock()
+	n := exp.notifier
+	s.mu.Unlock()
+	if n != nil {
+		r := req.Clone(req.Context())
+		r.Body = io.NopCloser(bytes.NewReader(truncateBody(prefix)))
+		n.send(r)
+	}
+
+	if resp.bodyStream != nil {
+		if err := resp.bodyStream(req.Body); err != nil {
+			s.t.Errorf("Unexpected body for %s: %v", exp.describe(), err)
+		}
+	}
+
+	if resp.discardBody {
+		_, _ = io.Copy(io.Discard, req.Body)
+	}
+
+	if resp.dropConn || resp.hang {
+		if resp.hang {
+			select {
+			case <-req.Context().Done():
+			case <-s.done:
+			}
+		}
+
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			s.t.Errorf("Unable to drop connection for %s: %v", exp.describe(), err)
+			return exp, rec
+		}
+		_ = conn.Close()
+		return exp, rec
+	}
+
+	if resp.headerDelay > 0 || resp.bodyDelay > 0 {
+		w = &delayWriter{ResponseWriter: w, req: req, header: resp.headerDelay, body: resp.bodyDelay}
+	}
+
+	for j := 0; j < len(resp.headers); j += 2 {
+		w.Header().Del(resp.headers[j])
+	}
+	for j := 0; j < len(resp.headers); j += 2 {
+		w.Header().Add(resp.headers[j], resp.headers[j+1])
+	}
+	if resp.contentType != "" && !hasHeader(resp.headers, "Content-Type") {
+		w.Header().Set("Content-Type", resp.contentType)
+	}
+	for _, c := range resp.cookies {
+		http.SetCookie(w, c)
+	}
+
+	switch {
+	case resp.fn != nil:
+		resp.fn(w, req)
+	case resp.returnsFn != nil:
+		status, body := resp.returnsFn(req)
+		w.WriteHeader(status)
+		if len(body) > 0 {
+			_, _ = w.Write(body)
+		}
+	case resp.tmplPath != "":
+		b, err := resp.renderTemplate(req)
+		if err != nil {
+			s.t.Errorf("Unable to render template %s: %v", resp.tmplPath, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			break
+		}
+		w.WriteHeader(resp.status)
+		_, _ = w.Write(b)
+	case len(resp.seq) > 0:
+		res := resp.seq[len(resp.seq)-1]
+		if call < len(resp.seq) {
+			res = resp.seq[call]
+		}
+		w.WriteHeader(res.Status)
+		if len(res.Body) > 0 {
+			_, _ = w.Write(res.Body)
+		}
+	case resp.negotiate != nil:
+		typ, ok := negotiate(req.Header.Values("Accept"), resp.negotiate)
+		if !ok {
+			w.WriteHeader(http.StatusNotAcceptable)
+			break
+		}
+		res := resp.negotiate[typ]
+		w.Header().Set("Content-Type", typ)
+		w.WriteHeader(res.Status)
+		if len(res.Body) > 0 {
+			_, _ = w.Write(res.Body)
+		}
+	case resp.bodyErr != nil:
+		s.t.Errorf("Unable to create body for %s: %v", exp.describe(), resp.bodyErr)
+		w.WriteHeader(http.StatusInternalServerError)
+	case resp.hasReader:
+		r, n := exp.takeReader()
+		if r == nil {
+			w.Header().Set("Content-Length", "0")
+			w.WriteHeader(resp.status)
+			break
+		}
+		if n >= 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+		}
+		w.WriteHeader(resp.status)
+		_, _ = io.Copy(w, r)
+	default:
+		w.WriteHeader(resp.status)
+		if len(resp.body) > 0 {
+			_, _ = w.Write(resp.body)
+		}
+	}
+
+	return exp, rec
+}
+
+// match finds the expectation matching the request, counting the call.
+// The number of previous calls to the expectation is returned, or the
+// unsatisfied expectation the matched expectation must come after.
+// hasHeader determines if the header key/value pairs contain the key.
+func hasHeader(pairs []string, k string) bool {
+	k = http.CanonicalHeaderKey(k)
+	for j := 0; j < len(pairs); j += 2 {
+		if http.CanonicalHeaderKey(pairs[j]) == k {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) match(req *http.Request, prefix []byte, rec Request) (*Expectation, int, *Expectation) {
+	// User matchers are run without the lock held, allowing them to inspect the server.
+	matched := map[*Expectation]bool{}
+	for _, c := range s.candidates(req) {
+		if c.matches(req, prefix) {
+			matched[c.exp] = true
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.notifyChanged()
+
+	s.requests = append(s.requests, rec)
+
+	// Expectations that must never be matched take precedence.
+	for _, exp := range s.expect {
+		if exp.never && matched[exp] {
+			return exp, s.recordCall(exp, req, rec), nil
+		}
+	}
+
+	for i, exp := range s.expect {
+		if exp.never || exp.maxCalls >= 0 && exp.calls >= exp.maxCalls {
+			continue
+		}
+		if !matched[exp] {
+			continue
+		}
+
+		for _, other := range exp.after {
+			if !other.satisfied() {
+				return exp, 0, other
+			}
+		}
+
+		call := s.recordCall(exp, req, rec)
+		if exp.calls == exp.maxCalls {
+			s.expect = append(s.expect[:i], s.expect[i+1:]...)
+		}
+		return exp, call, nil
+	}
+	return nil, 0, nil
 }
 
-// Times sets the number of times the request can be made.
-func (e *Expectation) Times(times int) *Expectation {
-	e.times = times
-	e.called = times
+// candidate is an expectation matching a request, pending its user matchers.
+type candidate struct {
+	exp          *Expectation
+	bodyMatchers []bodyMatcher
+	matchFns     []func(*http.Request) bool
+}
 
-	return e
+// candidates returns the expectations matching the request, with the
+// matchers still to be run.
+func (s *Server) candidates(req *http.Request) []candidate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var cs []candidate
+	for _, exp := range s.expect {
+		if !requestMatches(req, exp) {
+			continue
+		}
+		cs = append(cs, candidate{exp: exp, bodyMatchers: exp.bodyMatchers, matchFns: exp.matchFns})
+	}
+	return cs
 }
 
-// Header sets the HTTP headers that should be returned.
-func (e *Expectation) Header(k, v string) *Expectation {
-	e.headers = append(e.headers, k, v)
+// matches determines if the request body prefix and request satisfy the matchers.
+func (c candidate) matches(req *http.Request, prefix []byte) bool {
+	for _, m := range c.bodyMatchers {
+		if !m.matches(prefix) {
+			return false
+		}
+	}
 
-	return e
+	for _, fn := range c.matchFns {
+		r := req.Clone(req.Context())
+		r.Body = io.NopCloser(bytes.NewReader(truncateBody(prefix)))
+		if !fn(r) {
+			return false
+		}
+	}
+	return true
 }
 
-// Handle sets the HTTP handler function to be run on the request.
-func (e *Expectation) Handle(fn http.HandlerFunc) {
-	e.fn = fn
+// recordCall records the request as a call to the expectation, returning
+// the number of previous calls. The lock must be held.
+func (s *Server) recordCall(exp *Expectation, req *http.Request, rec Request) int {
+	rec.PathValues = exp.pathMatch(req).values
+	s.requests[len(s.requests)-1] = rec
+	exp.requests = append(exp.requests, rec)
+
+	call := exp.calls
+	exp.calls++
+	return call
 }
 
-// ReturnsStatus sets the HTTP stats code to return.
-func (e *Expectation) ReturnsStatus(status int) {
-	e.body = []byte{}
-	e.status = status
+type statusRecorder struct {
+	http.ResponseWriter
+
+	status      int
+	wroteHeader bool
+	dropped     bool
+
+	keepBody bool
+	body     []byte
 }
 
-// Returns sets the HTTP stats and body bytes to return.
-func (e *Expectation) Returns(status int, body []byte) {
-	e.body = body
-	e.status = status
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if r.keepBody && len(r.body) < maxRecordedBodySize {
+		n := len(b)
+		if rem := maxRecordedBodySize - len(r.body); n > rem {
+			n = rem
+		}
+		r.body = append(r.body, b[:n]...)
+	}
+	return r.ResponseWriter.Write(b)
 }
 
-// ReturnsString sets the HTTP stats and body string to return.
-func (e *Expectation) ReturnsString(status int, body string) {
-	e.body = []byte(body)
-	e.status = status
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
 }
 
-// Server represents a mock http server.
-type Server struct {
-	t   *testing.T
-	srv *httptest.Server
+// Hijack hijacks the connection, recording the request as dropped.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	r.status = 0
+	r.dropped = true
+	return conn, rw, nil
+}
 
-	expect []*Expectation
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
 }
 
-// NewServer creates a new mock http server.
-func NewServer(t *testing.T) *Server {
-	t.Helper()
+// maxLoggedBodySize is the maximum number of body bytes logged for a request.
+const maxLoggedBodySize = 1 << 10
 
-	srv := &Server{
-		t: t,
+func (s *Server) logRequest(rec Request, exp, blockedBy *Expectation) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s", rec.Method, rec.URL.String())
+	switch {
+	case blockedBy != nil:
+		fmt.Fprintf(&sb, " matched=%q blocked by %q", exp.describe(), blockedBy.describe())
+	case exp != nil:
+		fmt.Fprintf(&sb, " matched=%q", exp.describe())
+	default:
+		sb.WriteString(" matched=<none>")
 	}
-	srv.srv = httptest.NewServer(http.HandlerFunc(srv.handler))
 
-	return srv
+	keys := make([]string, 0, len(rec.Header))
+	for k := range rec.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "\n  %s: %s", k, strings.Join(rec.Header[k], ", "))
+	}
+
+	if len(rec.Body) > 0 {
+		body := rec.Body
+		if len(body) > maxLoggedBodySize {
+			body = body[:maxLoggedBodySize]
+		}
+		fmt.Fprintf(&sb, "\n  Body: %q", body)
+		if len(rec.Body) > maxLoggedBodySize {
+			sb.WriteString(" (truncated)")
+		}
+	}
+
+	logf(s.t, "%s", sb.String())
 }
 
-// URL returns the url of the mock server.
-func (s *Server) URL() string {
-	return s.srv.URL
+// notifier delivers requests on a channel without blocking the sender.
+type notifier struct {
+	mu    sync.Mutex
+	queue []*http.Request
+	ready chan struct{}
+	out   chan *http.Request
 }
 
-func (s *Server) handler(w http.ResponseWriter, req *http.Request) {
-	for i, exp := range s.expect {
-		if !requestMatches(req, exp) {
-			continue
-		}
+func newNotifier(done <-chan struct{}) *notifier {
+	n := &notifier{
+		ready: make(chan struct{}, 1),
+		out:   make(chan *http.Request),
+	}
+	go n.run(done)
+	return n
+}
+
+func (n *notifier) send(req *http.Request) {
+	n.mu.Lock()
+	n.queue = append(n.queue, req)
+	n.mu.Unlock()
+
+	select {
+	case n.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (n *notifier) run(done <-chan struct{}) {
+	defer close(n.out)
 
-		for j := 0; j < len(exp.headers); j += 2 {
-			w.Header().Add(exp.headers[j], exp.headers[j+1])
+	for {
+		n.mu.Lock()
+		var req *http.Request
+		if len(n.queue) > 0 {
+			req = n.queue[0]
+			n.queue = n.queue[1:]
 		}
+		n.mu.Unlock()
 
-		if exp.fn != nil {
-			exp.fn(w, req)
-		} else {
-			w.WriteHeader(exp.status)
-			if len(exp.body) > 0 {
-				_, _ = w.Write(exp.body)
+		if req == nil {
+			select {
+			case <-n.ready:
+				continue
+			case <-done:
+				return
 			}
 		}
 
-		exp.called--
-		if exp.called == 0 {
-			s.expect = append(s.expect[:i], s.expect[i+1:]...)
+		select {
+		case n.out <- req:
+		case <-done:
+			return
 		}
+	}
+}
+
+// delayWriter delays writing the response headers and body.
+type delayWriter struct {
+	http.ResponseWriter
+
+	req    *http.Request
+	header time.Duration
+	body   time.Duration
+
+	wroteHeader bool
+}
+
+func (w *delayWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	sleepCtx(w.req, w.header)
+	w.ResponseWriter.WriteHeader(status)
+	if w.body > 0 {
+		_ = http.NewResponseController(w.ResponseWriter).Flush()
+		sleepCtx(w.req, w.body)
+	}
+}
+
+func (w *delayWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *delayWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// sleepCtx sleeps for d or until the request is cancelled.
+func sleepCtx(req *http.Request, d time.Duration) {
+	if d <= 0 {
 		return
 	}
 
-	s.t.Errorf("Unexpected call to %s %s", req.Method, req.URL.String())
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-req.Context().Done():
+	}
+}
+
+// bodyPrefixLimit returns the longest body prefix needed by the expectations
+// or for recording.
+func (s *Server) bodyPrefixLimit() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limit := int64(maxRecordedBodySize)
+	for _, exp := range s.expect {
+		if exp.bodyStream != nil {
+			limit = 0
+			break
+		}
+	}
+	for _, exp := range s.expect {
+		if len(exp.matchFns) > 0 && limit < maxRecordedBodySize {
+			limit = maxRecordedBodySize
+		}
+		for _, m := range exp.bodyMatchers {
+			if m.limit > limit {
+				limit = m.limit
+			}
+		}
+	}
+	return limit
+}
+
+// readBodyPrefix reads at most limit bytes of the body, leaving the full
+// body readable on the request. Any error reading the prefix is returned
+// when reading past it.
+func readBodyPrefix(req *http.Request, limit int64) []byte {
+	prefix, err := io.ReadAll(io.LimitReader(req.Body, limit))
+	rest := req.Body
+	if err != nil {
+		rest = readCloser{Reader: errReader{err: err}, Closer: req.Body}
+	}
+	req.Body = readCloser{
+		Reader: io.MultiReader(bytes.NewReader(prefix), rest),
+		Closer: req.Body,
+	}
+	return prefix
+}
+
+// decodeBodyPrefix decodes a gzip encoded body prefix for matching.
+// The prefix is returned as is if the body is not gzip encoded or cannot be decoded.
+func decodeBodyPrefix(req *http.Request, prefix []byte, limit int64) []byte {
+	switch strings.ToLower(req.Header.Get("Content-Encoding")) {
+	case "gzip", "x-gzip":
+	default:
+		return prefix
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(prefix))
+	if err != nil {
+		return prefix
+	}
+	defer func() { _ = r.Close() }()
+
+	// The prefix may be truncated, keep what could be decoded.
+	b, err := io.ReadAll(io.LimitReader(r, limit))
+	if err != nil && len(b) == 0 {
+		return prefix
+	}
+	return b
+}
+
+type errReader struct {
+	err error
 }
 
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type bodyMatcher struct {
+	limit int64
+	fn    func([]byte) bool
+}
+
+func (m bodyMatcher) matches(prefix []byte) bool {
+	if int64(len(prefix)) > m.limit {
+		prefix = prefix[:m.limit]
+	}
+	return m.fn(prefix)
+}
+
+// requestMatches determines if the request matches the expectation,
+// excluding body and function matchers. The lock must be held.
 func requestMatches(req *http.Request, exp *Expectation) bool {
 	if exp.method != req.Method && exp.method != Anything {
 		return false
 	}
 
-	if exp.path != Anything && !glob.Glob(exp.path, req.URL.Path) {
+	switch {
+	case exp.pathRe != nil:
+		if !exp.pathRe.MatchString(req.URL.Path) {
+			return false
+		}
+	case exp.path == Anything:
+	case exp.pattern != nil:
+		if _, ok := exp.pattern.match(req.URL.EscapedPath()); !ok {
+			return false
+		}
+	case !glob.Glob(exp.path, req.URL.Path):
 		return false
 	}
 
@@ -170,9 +1848,61 @@ func requestMatches(req *http.Request, exp *Expectation) bool {
 		}
 	}
 
+	for i := 0; i < len(exp.matchHeaders); i += 2 {
+		if !headerMatches(req.Header.Values(exp.matchHeaders[i]), exp.matchHeaders[i+1]) {
+			return false
+		}
+	}
+
+	for i := 0; i < len(exp.matchCookies); i += 2 {
+		var vals []string
+		for _, c := range req.Cookies() {
+			if c.Name == exp.matchCookies[i] {
+				vals = append(vals, c.Value)
+			}
+		}
+		if !headerMatches(vals, exp.matchCookies[i+1]) {
+			return false
+		}
+	}
+
+	for _, k := range exp.withoutHeaders {
+		if _, ok := req.Header[http.CanonicalHeaderKey(k)]; ok {
+			return false
+		}
+	}
+
+	if exp.exactHeaders != nil {
+		if len(req.Header) != len(exp.exactHeaders) {
+			return false
+		}
+		for k, v := range exp.exactHeaders {
+			got, ok := req.Header[k]
+			if !ok || len(got) != len(v) || !elementsMatch(v, got) {
+				return false
+			}
+		}
+	}
+
+	if exp.clientCertCN != "" {
+		if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 ||
+			req.TLS.PeerCertificates[0].Subject.CommonName != exp.clientCertCN {
+			return false
+		}
+	}
+
 	return true
 }
 
+func headerMatches(vals []string, pattern string) bool {
+	for _, v := range vals {
+		if pattern == Anything || glob.Glob(pattern, v) {
+			return true
+		}
+	}
+	return false
+}
+
 // On creates an expectation of a request on the server.
 func (s *Server) On(method, path string) *Expectation {
 	var qry *url.Values
@@ -183,51 +1913,289 @@ func (s *Server) On(method, path string) *Expectation {
 		}
 	}
 
-	exp := &Expectation{
-		method: method,
-		path:   path,
-		qry:    qry,
-		times:  -1,
-		called: -1,
-		status: 200,
+	exp := newExpectation(s, method, path)
+	exp.qry = qry
+	if isPathPattern(path) {
+		exp.pattern = newPathPattern(path)
+	}
+
+	return s.add(exp)
+}
+
+// add adds the expectation to the server.
+func (s *Server) add(exp *Expectation) *Expectation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inOrder && s.last != nil {
+		exp.after = append(exp.after, s.last)
 	}
+	s.last = exp
 	s.expect = append(s.expect, exp)
 
 	return exp
 }
 
+// NotOn creates an expectation of a request that must never be made on the server.
+func (s *Server) NotOn(method, path string) *Expectation {
+	return s.On(method, path).Never()
+}
+
+// OnRegexp creates an expectation of a request on the server with a path
+// matching the regular expression. The expression is anchored, so it must
+// match the whole path. The submatches are available to handlers
+// with PathSubmatches, and named groups with PathValue.
+func (s *Server) OnRegexp(method string, pathRe *regexp.Regexp) *Expectation {
+	exp := newExpectation(s, method, pathRe.String())
+	exp.pathRe = regexp.MustCompile(`^(?:` + pathRe.String() + `)$`)
+
+	return s.add(exp)
+}
+
+// DefaultHeader sets a header returned on every response. Headers set
+// on an expectation replace the default header.
+func (s *Server) DefaultHeader(k, v string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.headers == nil {
+		s.headers = http.Header{}
+	}
+	s.headers.Set(k, v)
+}
+
+// Fallback sets the handler for requests that do not match any expectation,
+// instead of failing the test. Unmatched requests are still recorded.
+func (s *Server) Fallback(fn http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fallback = fn
+}
+
+// InOrder requires expectations created after this call to be
+// satisfied in the order they are created.
+func (s *Server) InOrder() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inOrder = true
+	s.last = nil
+}
+
 // AssertExpectations asserts all expectations have been met.
 func (s *Server) AssertExpectations() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	assertExpectations(s.t.Errorf, s.expect)
+}
+
+// assertExpectations reports the expectations that have not been met.
+// The lock must be held.
+func assertExpectations(errorf func(format string, args ...interface{}), exps []*Expectation) {
+	for _, exp := range exps {
+		call := exp.describe()
+
+		switch {
+		case exp.satisfied():
+		case exp.minCalls == exp.maxCalls:
+			errorf("Expected a call to %s %d times but got called %d times", call, exp.minCalls, exp.calls)
+		case exp.minCalls == 1:
+			errorf("Expected a call to %s but got none", call)
+		default:
+			errorf("Expected a call to %s at least %d times but got called %d times", call, exp.minCalls, exp.calls)
+		}
+	}
+}
+
+// Reset removes all expectations and recorded requests from the server.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expect = nil
+	s.requests = nil
+	s.inOrder = false
+	s.last = nil
+	atomic.StoreInt64(&s.numRequests, 0)
+}
+
+// remove removes the expectations from the server.
+func (s *Server) remove(exps []*Expectation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expect := s.expect[:0]
 	for _, exp := range s.expect {
-		var call string
-		if exp.method != Anything {
-			call = exp.method
+		if !containsExpectation(exps, exp) {
+			expect = append(expect, exp)
 		}
-		if exp.path != Anything {
-			if call != "" {
-				call += " "
-			}
-			call += exp.path
+	}
+	s.expect = expect
+	if containsExpectation(exps, s.last) {
+		s.last = nil
+	}
+}
+
+func containsExpectation(exps []*Expectation, exp *Expectation) bool {
+	for _, e := range exps {
+		if e == exp {
+			return true
+		}
+	}
+	return false
+}
+
+// Requests returns all requests received by the server.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// countCalls returns the number of requests received matching the method and path.
+// The method can be Anything, and the path can be Anything, a path pattern or
+// contain wildcards.
+func (s *Server) countCalls(method, path string) int {
+	var pattern *pathPattern
+	if isPathPattern(path) {
+		pattern = newPathPattern(path)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for _, req := range s.requests {
+		if method != Anything && req.Method != method {
+			continue
 		}
-		if exp.qry != nil {
-			if call != "" || exp.path == Anything {
-				call += " "
+		switch {
+		case path == Anything:
+		case pattern != nil:
+			if _, ok := pattern.match(req.URL.EscapedPath()); !ok {
+				continue
 			}
-			call += exp.qry.Encode()
+		case !glob.Glob(path, req.URL.Path):
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// AssertCalled asserts the server received a request with the method and path.
+func (s *Server) AssertCalled(method, path string) {
+	if s.countCalls(method, path) == 0 {
+		s.t.Errorf("Expected a call to %s %s but got none", method, path)
+	}
+}
+
+// AssertNotCalled asserts the server received no request with the method and path.
+func (s *Server) AssertNotCalled(method, path string) {
+	if n := s.countCalls(method, path); n > 0 {
+		s.t.Errorf("Expected no calls to %s %s but got called %d times", method, path, n)
+	}
+}
+
+// AssertNumberOfCalls asserts the server received a request with the method
+// and path the given number of times.
+func (s *Server) AssertNumberOfCalls(method, path string, times int) {
+	if n := s.countCalls(method, path); n != times {
+		s.t.Errorf("Expected a call to %s %s %d times but got called %d times", method, path, times, n)
+	}
+}
+
+// notifyChanged wakes all waiters. The lock must be held.
+func (s *Server) notifyChanged() {
+	if s.changed != nil {
+		close(s.changed)
+		s.changed = nil
+	}
+}
+
+// waitFor waits until cond is true or the timeout elapses, returning
+// if the condition was met. The condition is checked with the lock held.
+func (s *Server) waitFor(timeout time.Duration, cond func() bool) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		if cond() {
+			s.mu.Unlock()
+			return true
+		}
+		if s.changed == nil {
+			s.changed = make(chan struct{})
+		}
+		ch := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-ch:
+		case <-timer.C:
+			return false
 		}
+	}
+}
+
+// WaitForRequests waits until at least n requests have been received by the
+// server, failing the test if they are not received within the timeout.
+func (s *Server) WaitForRequests(n int, timeout time.Duration) {
+	var got int
+	ok := s.waitFor(timeout, func() bool {
+		got = len(s.requests)
+		return got >= n
+	})
+	if !ok {
+		s.t.Errorf("Expected %d requests within %s but got %d", n, timeout, got)
+	}
+}
+
+// AssertDeadlinePropagated asserts all requests received by the server
+// propagated a remaining deadline between atLeast and atMost.
+func (s *Server) AssertDeadlinePropagated(atLeast, atMost time.Duration) {
+	reqs := s.Requests()
+	if len(reqs) == 0 {
+		s.t.Errorf("Expected requests with a propagated deadline but got none")
+		return
+	}
 
+	for _, req := range reqs {
 		switch {
-		case exp.called == -1:
-			s.t.Errorf("Expected a call to %s but got none", call)
-		case exp.called > 0:
-			s.t.Errorf("Expected a call to %s %d times but got called %d times", call, exp.times, exp.times-exp.called)
+		case req.Deadline == 0:
+			s.t.Errorf("Expected %s %s to propagate a deadline but got none", req.Method, req.URL.String())
+		case req.Deadline < atLeast || req.Deadline > atMost:
+			s.t.Errorf("Expected %s %s to propagate a deadline between %s and %s but got %s", req.Method, req.URL.String(), atLeast, atMost, req.Deadline)
 		}
 	}
 }
 
-// Close closes the server.
+// AssertQuiet asserts no requests are made to the server for the duration d.
+func (s *Server) AssertQuiet(d time.Duration) {
+	before := atomic.LoadInt64(&s.numRequests)
+	time.Sleep(d)
+
+	if n := atomic.LoadInt64(&s.numRequests) - before; n > 0 {
+		s.t.Errorf("Expected no calls for %s but got %d", d, n)
+	}
+}
+
+// Close closes the server. Servers are closed when the test completes,
+// unless created with WithoutAutoClose.
 func (s *Server) Close() {
-	s.srv.Close()
+	s.closeOnce.Do(func() {
+		close(s.done)
+		if !s.noListener {
+			s.srv.Close()
+		}
+		if s.journal != nil {
+			_ = s.journal.close()
+		}
+	})
 }
 
 func elementsMatch(a, b []string) bool {
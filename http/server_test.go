@@ -1,16 +1,202 @@
 package http_test
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	httptest "github.com/hamba/testutils/http"
+	"github.com/hamba/testutils/netutil"
+	"github.com/hamba/testutils/tlstest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
 )
 
+func TestServer_WithReadTimeout(t *testing.T) {
+	s := httptest.NewServer(t, httptest.WithReadTimeout(50*time.Millisecond))
+	t.Cleanup(s.Close)
+
+	readErr := make(chan error, 1)
+	s.On(http.MethodPost, "/test/path").Handle(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.Copy(io.Discard, r.Body)
+		readErr <- err
+	})
+
+	pr, pw := io.Pipe()
+	t.Cleanup(func() { _ = pw.Close() })
+	go func() {
+		// Write part of the body, then stall the upload.
+		_, _ = pw.Write([]byte("partial"))
+	}()
+
+	go func() {
+		res, err := http.Post(s.URL()+"/test/path", "text/plain", pr)
+		if err == nil {
+			_ = res.Body.Close()
+		}
+	}()
+
+	select {
+	case err := <-readErr:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Error("Expected read to time out")
+	}
+}
+
+func TestServer_WithWriteTimeout(t *testing.T) {
+	s := httptest.NewServer(t, httptest.WithWriteTimeout(50*time.Millisecond))
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").Handle(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte("test"))
+	})
+
+	res, err := http.Get(s.URL() + "/test/path")
+	if err == nil {
+		_, err = io.ReadAll(res.Body)
+		_ = res.Body.Close()
+	}
+	assert.Error(t, err)
+}
+
+func TestServer_WithContinueDelay(t *testing.T) {
+	s := httptest.NewServer(t, httptest.WithContinueDelay(100*time.Millisecond))
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodPut, "/test/path").ReturnsStatus(200)
+
+	start := time.Now()
+	res, err := doContinueRequest(t, s.URL()+"/test/path")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	assert.Equal(t, 200, res.StatusCode)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	reqs := s.Requests()
+	require.Len(t, reqs, 1)
+	assert.Equal(t, []byte("test body"), reqs[0].Body)
+}
+
+func TestServer_WithContinueRefused(t *testing.T) {
+	s := httptest.NewServer(t, httptest.WithContinueRefused(http.StatusExpectationFailed))
+	t.Cleanup(s.Close)
+
+	res, err := doContinueRequest(t, s.URL()+"/test/path")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	assert.Equal(t, http.StatusExpectationFailed, res.StatusCode)
+	reqs := s.Requests()
+	require.Len(t, reqs, 1)
+	assert.Empty(t, reqs[0].Body)
+}
+
+func TestServer_WithAccessLog(t *testing.T) {
+	mockT := newMockT()
+
+	s := httptest.NewServer(mockT, httptest.WithAccessLog())
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").ReturnsStatus(http.StatusAccepted)
+	s.On(http.MethodGet, "/dropped").DropsConnection()
+
+	_, err := http.Get(s.URL() + "/dropped")
+	require.Error(t, err)
+	res, err := http.Get(s.URL() + "/test/path?a=b")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+	_ = res.Body.Close()
+	s.AssertExpectations()
+	s.Close()
+
+	logs := mockT.Logs()
+	require.Len(t, logs, 2)
+	assert.Regexp(t, `^GET /dropped matched="GET /dropped" status=dropped duration=\d`, logs[0])
+	assert.Regexp(t, `^GET /test/path\?a=b matched="GET /test/path" status=202 duration=\d`, logs[1])
+}
+
+func TestServer_WithRequestLogging(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		want     []string
+		wantBody string
+	}{
+		{
+			name: "matched",
+			path: "/test/path",
+			body: "test body",
+			want: []string{
+				`POST /test/path matched="POST /test/path"`,
+				"\n  Content-Type: text/plain",
+			},
+			wantBody: `Body: "test body"`,
+		},
+		{
+			name: "unmatched",
+			path: "/other",
+			body: "test body",
+			want: []string{
+				"POST /other matched=<none>",
+				"\n  Content-Type: text/plain",
+			},
+			wantBody: `Body: "test body"`,
+		},
+		{
+			name: "truncated",
+			path: "/test/path",
+			body: strings.Repeat("a", 2048),
+			want: []string{
+				`POST /test/path matched="POST /test/path"`,
+			},
+			wantBody: `Body: "` + strings.Repeat("a", 1024) + `" (truncated)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockT := newMockT()
+
+			s := httptest.NewServer(mockT, httptest.WithRequestLogging())
+			t.Cleanup(s.Close)
+
+			s.On(http.MethodPost, "/test/path").ReturnsStatus(http.StatusAccepted)
+
+			res, err := http.Post(s.URL()+tt.path, "text/plain", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			_ = res.Body.Close()
+			s.Close()
+
+			logs := mockT.Logs()
+			require.Len(t, logs, 1)
+			for _, want := range tt.want {
+				assert.Contains(t, logs[0], want)
+			}
+			assert.True(t, strings.HasSuffix(logs[0], "\n  "+tt.wantBody), logs[0])
+		})
+	}
+}
+
 func TestServer_HandlesExpectation(t *testing.T) {
 	s := httptest.NewServer(t)
 	t.Cleanup(s.Close)
@@ -24,6 +210,159 @@ func TestServer_HandlesExpectation(t *testing.T) {
 	s.AssertExpectations()
 }
 
+func TestTLSServer_HandlesExpectation(t *testing.T) {
+	s := httptest.NewTLSServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").ReturnsString(200, "test")
+
+	assert.True(t, strings.HasPrefix(s.URL(), "https://"))
+	res, err := s.Client().Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = res.Body.Close() })
+
+	assert.Equal(t, 200, res.StatusCode)
+	assert.NotNil(t, res.TLS)
+	s.AssertExpectations()
+}
+
+func TestTLSServer_RequireClientCert(t *testing.T) {
+	ca := tlstest.NewCA(t, "Test CA")
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+
+	s := httptest.NewTLSServer(t)
+	t.Cleanup(s.Close)
+	s.RequireClientCert(pool)
+
+	s.On(http.MethodGet, "/test/path").MatchClientCertCN("client-a").ReturnsString(200, "test")
+
+	c := s.Client()
+	_, err := c.Get(s.URL() + "/test/path")
+	require.Error(t, err)
+
+	c.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{
+		ca.NewLeaf(t, "client-a").TLSCertificate(),
+	}
+	res, err := c.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	assert.Equal(t, 200, res.StatusCode)
+	s.AssertExpectations()
+}
+
+func TestTLSServer_HandlesUnexpectedClientCertCN(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+	ca := tlstest.NewCA(t, "Test CA")
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+
+	s := httptest.NewTLSServer(mockT)
+	t.Cleanup(s.Close)
+	s.RequireClientCert(pool)
+
+	s.On(http.MethodGet, "/test/path").MatchClientCertCN("client-a")
+
+	c := s.Client()
+	c.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{
+		ca.NewLeaf(t, "client-b").TLSCertificate(),
+	}
+	res, err := c.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+}
+
+func TestServer_WithHTTP2(t *testing.T) {
+	s := httptest.NewServer(t, httptest.WithHTTP2())
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").Handle(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		_, _ = w.Write([]byte(r.Proto))
+		w.Header().Set("X-Checksum", "abc")
+	})
+
+	c := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	res, err := c.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = res.Body.Close() })
+
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(t, "HTTP/2.0", string(b))
+	assert.Equal(t, "abc", res.Trailer.Get("X-Checksum"))
+}
+
+func TestTLSServer_WithHTTP2(t *testing.T) {
+	s := httptest.NewTLSServer(t, httptest.WithHTTP2())
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").ReturnsString(200, "test")
+
+	res, err := s.Client().Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	assert.Equal(t, 2, res.ProtoMajor)
+}
+
+func TestUnstartedServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := httptest.NewUnstartedServer(t)
+	s.Listener(l)
+	s.On(http.MethodGet, "/test/path").ReturnsString(200, "test")
+
+	addr := s.Addr()
+	s.Start()
+	t.Cleanup(s.Close)
+
+	assert.Equal(t, l.Addr().String(), addr)
+	assert.Equal(t, "http://"+addr, s.URL())
+	res, err := http.Get("http://" + addr + "/test/path")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	assert.Equal(t, 200, res.StatusCode)
+	s.AssertExpectations()
+}
+
+func TestUnixServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.sock")
+
+	s := httptest.NewUnixServer(t, path)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").ReturnsString(200, "test")
+
+	res, err := s.Client().Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = res.Body.Close() })
+
+	assert.Equal(t, 200, res.StatusCode)
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(t, "test", string(b))
+	s.AssertExpectations()
+}
+
+func TestServer_WithPort(t *testing.T) {
+	port := netutil.ReservePort(t)
+
+	s := httptest.NewServer(t, httptest.WithPort(port))
+	t.Cleanup(s.Close)
+
+	assert.Equal(t, "http://127.0.0.1:"+strconv.Itoa(port), s.URL())
+}
+
 func TestServer_HandlesExpectationWithQuery(t *testing.T) {
 	s := httptest.NewServer(t)
 	t.Cleanup(s.Close)
@@ -73,12 +412,8 @@ func TestServer_HandlesWildcardPathExpectation(t *testing.T) {
 }
 
 func TestServer_HandlesUnexpectedMethodRequest(t *testing.T) {
-	mockT := new(testing.T)
-	t.Cleanup(func() {
-		if !mockT.Failed() {
-			t.Error("Expected error when no expectation on request")
-		}
-	})
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
 
 	s := httptest.NewServer(mockT)
 	t.Cleanup(s.Close)
@@ -88,13 +423,24 @@ func TestServer_HandlesUnexpectedMethodRequest(t *testing.T) {
 	_, _ = http.Get(s.URL() + "/test/path")
 }
 
+func TestServer_HandlesUnexpectedRequestWithTestingT(t *testing.T) {
+	mockT := new(MockTestingT)
+	mockT.On("Cleanup", mock.Anything)
+	mockT.On("Errorf", "Unexpected call to %s %s", mock.Anything).Once()
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+
+	res, err := http.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	mockT.AssertExpectations(t)
+}
+
 func TestServer_HandlesUnexpectedPathRequest(t *testing.T) {
-	mockT := new(testing.T)
-	t.Cleanup(func() {
-		if !mockT.Failed() {
-			t.Error("Expected error when no expectation on request")
-		}
-	})
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
 
 	s := httptest.NewServer(mockT)
 	t.Cleanup(s.Close)
@@ -106,12 +452,8 @@ func TestServer_HandlesUnexpectedPathRequest(t *testing.T) {
 }
 
 func TestServer_HandlesUnexpectedPathQueryRequest(t *testing.T) {
-	mockT := new(testing.T)
-	t.Cleanup(func() {
-		if !mockT.Failed() {
-			t.Error("Expected error when no expectation on request")
-		}
-	})
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
 
 	s := httptest.NewServer(mockT)
 	t.Cleanup(s.Close)
@@ -121,159 +463,1911 @@ func TestServer_HandlesUnexpectedPathQueryRequest(t *testing.T) {
 	_, _ = http.Get(s.URL() + "/test/path?p=somethingelse")
 }
 
-func TestServer_HandlesExpectationNTimes(t *testing.T) {
-	mockT := new(testing.T)
-	t.Cleanup(func() {
-		if !mockT.Failed() {
-			t.Error("Expected error when expectation times used")
-		}
-	})
-
-	s := httptest.NewServer(mockT)
+func TestServer_HandlesUnexpectedRequestWithFallback(t *testing.T) {
+	s := httptest.NewServer(t)
 	t.Cleanup(s.Close)
-	s.On(http.MethodGet, "/test/path").Times(2)
-
-	_, _ = http.Get(s.URL() + "/test/path")
-	_, _ = http.Get(s.URL() + "/test/path")
-	_, _ = http.Get(s.URL() + "/test/path")
-
-	s.AssertExpectations()
-}
 
-func TestServer_HandlesExpectationUnlimitedTimes(t *testing.T) {
-	mockT := new(testing.T)
-	t.Cleanup(func() {
-		if mockT.Failed() {
-			t.Error("Unexpected error on request")
-		}
+	s.Fallback(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
 	})
+	s.On(http.MethodGet, "/test/path").ReturnsStatus(200)
 
-	s := httptest.NewServer(mockT)
-	t.Cleanup(s.Close)
-	s.On(http.MethodGet, "/test/path")
+	res, err := http.Get(s.URL() + "/health")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
 
-	_, _ = http.Get(s.URL() + "/test/path")
-	_, _ = http.Get(s.URL() + "/test/path")
+	res, err = http.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
 
+	assert.Len(t, s.Requests(), 2)
 	s.AssertExpectations()
 }
 
-func TestServer_ExpectationReturnsBodyBytes(t *testing.T) {
+func TestServer_DefaultHeader(t *testing.T) {
 	s := httptest.NewServer(t)
 	t.Cleanup(s.Close)
 
-	s.On(http.MethodGet, "/test/path").Returns(400, []byte("test"))
+	s.DefaultHeader("Server", "test-server")
+	s.DefaultHeader("X-Env", "test")
+	s.Fallback(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	s.On(http.MethodGet, "/test/path").Header("X-Env", "override").ReturnsStatus(200)
 
 	res, err := http.Get(s.URL() + "/test/path")
 	require.NoError(t, err)
-	assert.Equal(t, 400, res.StatusCode)
-	b, _ := ioutil.ReadAll(res.Body)
-	assert.Equal(t, []byte("test"), b)
+	_ = res.Body.Close()
+	assert.Equal(t, "test-server", res.Header.Get("Server"))
+	assert.Equal(t, []string{"override"}, res.Header.Values("X-Env"))
 
+	res, err = http.Get(s.URL() + "/health")
+	require.NoError(t, err)
 	_ = res.Body.Close()
+	assert.Equal(t, "test-server", res.Header.Get("Server"))
+	assert.Equal(t, "test", res.Header.Get("X-Env"))
 }
 
-func TestServer_ExpectationReturnsBodyString(t *testing.T) {
-	s := httptest.NewServer(t)
-	t.Cleanup(s.Close)
+func TestServer_WithUnmatched(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       httptest.UnmatchedMode
+		wantStatus int
+	}{
+		{
+			name:       "not found",
+			mode:       httptest.UnmatchedNotFound,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "not implemented",
+			mode:       httptest.UnmatchedNotImplemented,
+			wantStatus: http.StatusNotImplemented,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(t, httptest.WithUnmatched(tt.mode))
+			t.Cleanup(s.Close)
+
+			res, err := http.Get(s.URL() + "/test/path")
+			require.NoError(t, err)
+			_ = res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+		})
+	}
+}
 
-	s.On(http.MethodGet, "/test/path").ReturnsString(400, "test")
+func TestServer_WithUnmatchedPanic(t *testing.T) {
+	s := httptest.NewServer(t, httptest.WithUnmatched(httptest.UnmatchedPanic))
+	t.Cleanup(s.Close)
 
-	res, err := http.Get(s.URL() + "/test/path")
-	require.NoError(t, err)
-	assert.Equal(t, 400, res.StatusCode)
-	b, _ := ioutil.ReadAll(res.Body)
-	assert.Equal(t, []byte("test"), b)
+	_, err := http.Get(s.URL() + "/test/path")
 
-	_ = res.Body.Close()
+	assert.Error(t, err)
 }
 
-func TestServer_ExpectationReturnsStatusCode(t *testing.T) {
+func TestServer_HandlesBodyPrefixExpectation(t *testing.T) {
 	s := httptest.NewServer(t)
 	t.Cleanup(s.Close)
 
-	s.On(http.MethodGet, "/test/path").ReturnsStatus(400)
+	s.On(http.MethodPost, "/test/path").
+		MatchBodyPrefix(6, func(prefix []byte) bool { return string(prefix) == "HEADER" }).
+		DiscardBody()
 
-	res, err := http.Get(s.URL() + "/test/path")
+	body := io.MultiReader(strings.NewReader("HEADER"), io.LimitReader(zeroReader{}, 64<<20))
+	res, err := http.Post(s.URL()+"/test/path", "application/octet-stream", body)
 	require.NoError(t, err)
-	assert.Equal(t, 400, res.StatusCode)
-	b, _ := ioutil.ReadAll(res.Body)
-	assert.Len(t, b, 0)
+	assert.Equal(t, 200, res.StatusCode)
+	s.AssertExpectations()
 
 	_ = res.Body.Close()
 }
 
-func TestServer_ExpectationReturnsHeaders(t *testing.T) {
+func TestServer_HandlesBodyPrefixExpectationKeepsBody(t *testing.T) {
 	s := httptest.NewServer(t)
 	t.Cleanup(s.Close)
 
-	s.On(http.MethodGet, "/test/path").Header("foo", "bar").ReturnsStatus(200)
+	var n int64
+	s.On(http.MethodPost, "/test/path").
+		MatchBodyPrefix(6, func(prefix []byte) bool { return string(prefix) == "HEADER" }).
+		Handle(func(w http.ResponseWriter, r *http.Request) {
+			n, _ = io.Copy(io.Discard, r.Body)
+		})
 
-	res, err := http.Get(s.URL() + "/test/path")
+	body := io.MultiReader(strings.NewReader("HEADER"), io.LimitReader(zeroReader{}, 1<<20))
+	res, err := http.Post(s.URL()+"/test/path", "application/octet-stream", body)
 	require.NoError(t, err)
-	v := res.Header.Get("foo")
-	assert.Equal(t, "bar", v)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, int64(6+1<<20), n)
 
 	_ = res.Body.Close()
 }
 
-func TestServer_ExpectationUsesHandleFunc(t *testing.T) {
+func TestServer_HandlesUnexpectedBodyPrefixRequest(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodPost, "/test/path").
+		MatchBodyPrefix(6, func(prefix []byte) bool { return string(prefix) == "HEADER" })
+
+	_, _ = http.Post(s.URL()+"/test/path", "text/plain", strings.NewReader("OTHER BODY"))
+}
+
+func TestServer_HandlesBodyStreamExpectation(t *testing.T) {
 	s := httptest.NewServer(t)
 	t.Cleanup(s.Close)
 
-	s.On(http.MethodGet, "/test/path").Handle(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(400)
+	first := make(chan string, 1)
+	s.On(http.MethodPost, "/events").WithBodyStream(func(r io.Reader) error {
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			var v map[string]int
+			if err := json.Unmarshal(sc.Bytes(), &v); err != nil {
+				return err
+			}
+			select {
+			case first <- sc.Text():
+			default:
+			}
+		}
+		return sc.Err()
 	})
 
-	res, err := http.Get(s.URL() + "/test/path")
+	pr, pw := io.Pipe()
+	go func() {
+		_, _ = pw.Write([]byte(`{"a":1}` + "\n"))
+		select {
+		case <-first:
+		case <-time.After(time.Second):
+			t.Error("Expected the first line to be validated before the body completed")
+		}
+		_, _ = pw.Write([]byte(`{"b":2}` + "\n"))
+		_ = pw.Close()
+	}()
+
+	res, err := http.Post(s.URL()+"/events", "application/x-ndjson", pr)
 	require.NoError(t, err)
-	assert.Equal(t, 400, res.StatusCode)
+	_ = res.Body.Close()
+
+	assert.Equal(t, 200, res.StatusCode)
+	s.AssertExpectations()
 }
 
-func TestServer_AssertExpectations(t *testing.T) {
-	mockT := new(testing.T)
-	t.Cleanup(func() {
-		if mockT.Failed() {
-			t.Error("Expected no error when asserting expectations")
-		}
-	})
+func TestServer_HandlesBodyStreamExpectationError(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected body for %s: %v", mock.Anything) })
 
 	s := httptest.NewServer(mockT)
 	t.Cleanup(s.Close)
-	s.On(http.MethodGet, "/").Times(1)
+	s.On(http.MethodPost, "/events").WithBodyStream(func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&map[string]int{})
+	})
 
-	_, err := http.Get(s.URL() + "/")
-	assert.NoError(t, err)
+	res, err := http.Post(s.URL()+"/events", "application/x-ndjson", strings.NewReader("not json"))
+	require.NoError(t, err)
+	_ = res.Body.Close()
+}
 
-	s.AssertExpectations()
+func TestServer_HandlesJSONBodyExpectation(t *testing.T) {
+	tests := []struct {
+		name string
+		want interface{}
+	}{
+		{
+			name: "struct",
+			want: struct {
+				Name string `json:"name"`
+				Tags []int  `json:"tags"`
+			}{Name: "foo", Tags: []int{1, 2}},
+		},
+		{
+			name: "map",
+			want: map[string]interface{}{"tags": []int{1, 2}, "name": "foo"},
+		},
+		{
+			name: "raw",
+			want: json.RawMessage(`{"tags":[1,2],"name":"foo"}`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(t)
+			t.Cleanup(s.Close)
+
+			s.On(http.MethodPost, "/test/path").JSONBody(tt.want)
+
+			res, err := http.Post(s.URL()+"/test/path", "application/json", strings.NewReader(`{
+				"name": "foo",
+				"tags": [1, 2]
+			}`))
+			require.NoError(t, err)
+			assert.Equal(t, 200, res.StatusCode)
+			s.AssertExpectations()
+
+			_ = res.Body.Close()
+		})
+	}
 }
 
-func TestServer_AssertExpectationsOnUnlimited(t *testing.T) {
-	mockT := new(testing.T)
-	t.Cleanup(func() {
-		if !mockT.Failed() {
-			t.Error("Expected error when asserting expectations")
-		}
-	})
+func TestServer_HandlesGzipBodyExpectation(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodPost, "/test/path").JSONBody(map[string]string{"id": "123"})
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, _ = gw.Write([]byte(`{"id":"123"}`))
+	require.NoError(t, gw.Close())
+	raw := append([]byte(nil), buf.Bytes()...)
+
+	req, err := http.NewRequest(http.MethodPost, s.URL()+"/test/path", &buf)
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	assert.Equal(t, 200, res.StatusCode)
+	reqs := s.Requests()
+	require.Len(t, reqs, 1)
+	assert.Equal(t, []byte(`{"id":"123"}`), reqs[0].Body)
+	assert.Equal(t, raw, reqs[0].RawBody)
+}
+
+func TestServer_HandlesUnexpectedJSONBodyRequest(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
 
 	s := httptest.NewServer(mockT)
 	t.Cleanup(s.Close)
-	s.On(http.MethodPost, "/")
+	s.On(http.MethodPost, "/test/path").JSONBody(map[string]string{"name": "foo"})
 
-	s.AssertExpectations()
+	_, _ = http.Post(s.URL()+"/test/path", "application/json", strings.NewReader(`{"name":"bar"}`))
 }
 
-func TestServer_AssertExpectationsOnNTimes(t *testing.T) {
-	mockT := new(testing.T)
-	t.Cleanup(func() {
-		if !mockT.Failed() {
-			t.Error("Expected error when asserting expectations")
-		}
-	})
+func TestServer_JSONBodyHandlesMarshalError(t *testing.T) {
+	mockT := newMockT()
 
 	s := httptest.NewServer(mockT)
 	t.Cleanup(s.Close)
-	s.On(http.MethodPost, "/").Times(1)
+	s.On(http.MethodPost, "/test/path").JSONBody(make(chan int))
 
-	s.AssertExpectations()
+	mockT.AssertCalled(t, "Errorf", "Unable to marshal JSON body for %s: %v", mock.Anything)
+}
+
+func TestServer_HandlesMatchFnExpectation(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodPost, "/test/path").MatchFn(func(r *http.Request) bool {
+		b, _ := io.ReadAll(r.Body)
+		return r.URL.Query().Get("a") == "b" && string(b) == "test body"
+	}).Handle(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(b)
+	})
+
+	res, err := http.Post(s.URL()+"/test/path?a=b", "text/plain", strings.NewReader("test body"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = res.Body.Close() })
+
+	b, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "test body", string(b))
+	s.AssertExpectations()
+}
+
+func TestServer_HandlesMatchFnInspectingServer(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	login := s.On(http.MethodPost, "/login").Maybe()
+	s.On(http.MethodGet, "/test/path").MatchFn(func(r *http.Request) bool {
+		return login.CallCount() == 0
+	}).ReturnsStatus(http.StatusUnauthorized)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	res, err := client.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	s.AssertExpectations()
+}
+
+func TestServer_HandlesUnexpectedMatchFnRequest(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodGet, "/test/path").MatchFn(func(r *http.Request) bool {
+		return r.Header.Get("X-Test") != ""
+	})
+
+	doGet(t, s.URL()+"/test/path")
+}
+
+func TestServer_HandlesHeaderExpectation(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").
+		MatchHeader("Authorization", "Bearer *").
+		MatchHeader("X-Request-ID", httptest.Anything).
+		MatchHeader("Accept", "application/json")
+
+	req, err := http.NewRequest(http.MethodGet, s.URL()+"/test/path", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("X-Request-ID", "123")
+	req.Header.Add("Accept", "text/plain")
+	req.Header.Add("Accept", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	s.AssertExpectations()
+
+	_ = res.Body.Close()
+}
+
+func TestServer_HandlesUnexpectedHeaderRequest(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodGet, "/test/path").
+		MatchHeader("Authorization", "Bearer *").
+		MatchHeader("X-Request-ID", httptest.Anything)
+
+	req, err := http.NewRequest(http.MethodGet, s.URL()+"/test/path", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer token")
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = res.Body.Close()
+}
+
+func TestServer_HandlesCookieExpectation(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").
+		MatchCookie("session", "abc*").
+		MatchCookie("theme", httptest.Anything).
+		SetCookie(&http.Cookie{Name: "session", Value: "def", Path: "/"})
+
+	req, err := http.NewRequest(http.MethodGet, s.URL()+"/test/path", nil)
+	require.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc123"})
+	req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	assert.Equal(t, 200, res.StatusCode)
+	cookies := res.Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "session", cookies[0].Name)
+	assert.Equal(t, "def", cookies[0].Value)
+	s.AssertExpectations()
+}
+
+func TestServer_HandlesUnexpectedCookieRequest(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodGet, "/test/path").MatchCookie("session", "abc*")
+
+	req, err := http.NewRequest(http.MethodGet, s.URL()+"/test/path", nil)
+	require.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "def"})
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = res.Body.Close()
+}
+
+func TestServer_HandlesWithoutHeaderExpectation(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		wantErr bool
+	}{
+		{
+			name:    "absent",
+			header:  "X-Other",
+			wantErr: false,
+		},
+		{
+			name:    "present",
+			header:  "X-Debug",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockT := newMockT()
+
+			s := httptest.NewServer(mockT)
+			t.Cleanup(s.Close)
+			s.On(http.MethodGet, "/test/path").WithoutHeader("x-debug")
+
+			req, err := http.NewRequest(http.MethodGet, s.URL()+"/test/path", nil)
+			require.NoError(t, err)
+			req.Header.Set(tt.header, "1")
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			_ = res.Body.Close()
+
+			if tt.wantErr {
+				mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything)
+			} else {
+				mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestServer_HandlesWithExactHeadersExpectation(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "exact",
+			headers: map[string]string{"X-Request-ID": "123"},
+			wantErr: false,
+		},
+		{
+			name:    "extra",
+			headers: map[string]string{"X-Request-ID": "123", "X-Debug": "1"},
+			wantErr: true,
+		},
+		{
+			name:    "different value",
+			headers: map[string]string{"X-Request-ID": "456"},
+			wantErr: true,
+		},
+		{
+			name:    "missing",
+			headers: map[string]string{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockT := newMockT()
+
+			s := httptest.NewServer(mockT)
+			t.Cleanup(s.Close)
+			s.On(http.MethodGet, "/test/path").WithExactHeaders(http.Header{
+				"x-request-id":    {"123"},
+				"User-Agent":      {"test"},
+				"Accept-Encoding": {"gzip"},
+			})
+
+			req, err := http.NewRequest(http.MethodGet, s.URL()+"/test/path", nil)
+			require.NoError(t, err)
+			req.Header.Set("User-Agent", "test")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			_ = res.Body.Close()
+
+			if tt.wantErr {
+				mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything)
+			} else {
+				mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestServer_HandlesExpectationNTimes(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodGet, "/test/path").Times(2)
+
+	_, _ = http.Get(s.URL() + "/test/path")
+	_, _ = http.Get(s.URL() + "/test/path")
+	_, _ = http.Get(s.URL() + "/test/path")
+
+	s.AssertExpectations()
+}
+
+func TestServer_HandlesExpectationOnce(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodGet, "/test/path").Once()
+
+	_, _ = http.Get(s.URL() + "/test/path")
+	_, _ = http.Get(s.URL() + "/test/path")
+}
+
+func TestServer_HandlesExpectationTwice(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodGet, "/test/path").Twice()
+
+	_, _ = http.Get(s.URL() + "/test/path")
+	_, _ = http.Get(s.URL() + "/test/path")
+	_, _ = http.Get(s.URL() + "/test/path")
+}
+
+func TestServer_HandlesExpectationUnlimitedTimes(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodGet, "/test/path")
+
+	_, _ = http.Get(s.URL() + "/test/path")
+	_, _ = http.Get(s.URL() + "/test/path")
+
+	s.AssertExpectations()
+}
+
+func TestServer_ExpectationReturnsBodyBytes(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").Returns(400, []byte("test"))
+
+	res, err := http.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	assert.Equal(t, 400, res.StatusCode)
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(t, []byte("test"), b)
+
+	_ = res.Body.Close()
+}
+
+func TestServer_ExpectationReturnsBodyString(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").ReturnsString(400, "test")
+
+	res, err := http.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	assert.Equal(t, 400, res.StatusCode)
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(t, []byte("test"), b)
+
+	_ = res.Body.Close()
+}
+
+func TestServer_ExpectationReturnsReader(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentLength int64
+		wantLength    int64
+	}{
+		{
+			name:          "known length",
+			contentLength: 1 << 20,
+			wantLength:    1 << 20,
+		},
+		{
+			name:          "unknown length",
+			contentLength: -1,
+			wantLength:    -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(t)
+			t.Cleanup(s.Close)
+
+			s.On(http.MethodGet, "/test/path").Times(2).ReturnsReader(201, io.LimitReader(zeroReader{}, 1<<20), tt.contentLength)
+
+			res, err := http.Get(s.URL() + "/test/path")
+			require.NoError(t, err)
+			assert.Equal(t, 201, res.StatusCode)
+			assert.Equal(t, tt.wantLength, res.ContentLength)
+			n, err := io.Copy(io.Discard, res.Body)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1<<20), n)
+			_ = res.Body.Close()
+
+			res, err = http.Get(s.URL() + "/test/path")
+			require.NoError(t, err)
+			assert.Equal(t, 201, res.StatusCode)
+			assert.Equal(t, int64(0), res.ContentLength)
+			_ = res.Body.Close()
+		})
+	}
+}
+
+func TestServer_ExpectationReturnsSeq(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").
+		ReturnsSeq(503, nil).
+		ThenReturns(200, []byte("test"))
+
+	want := []struct {
+		status int
+		body   string
+	}{
+		{status: 503, body: ""},
+		{status: 200, body: "test"},
+		{status: 200, body: "test"},
+	}
+	for _, w := range want {
+		res, err := http.Get(s.URL() + "/test/path")
+		require.NoError(t, err)
+		b, _ := ioutil.ReadAll(res.Body)
+		_ = res.Body.Close()
+
+		assert.Equal(t, w.status, res.StatusCode)
+		assert.Equal(t, w.body, string(b))
+	}
+}
+
+func TestServer_ExpectationReturnsJSON(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").ReturnsJSON(201, map[string]string{"id": "123"})
+
+	res, err := http.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	assert.Equal(t, 201, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.JSONEq(t, `{"id":"123"}`, string(b))
+
+	_ = res.Body.Close()
+}
+
+func TestServer_ExpectationNegotiates(t *testing.T) {
+	tests := []struct {
+		name       string
+		accept     string
+		wantStatus int
+		wantType   string
+		wantBody   string
+	}{
+		{
+			name:       "exact",
+			accept:     "application/xml",
+			wantStatus: 200,
+			wantType:   "application/xml",
+			wantBody:   "<id>123</id>",
+		},
+		{
+			name:       "quality",
+			accept:     "application/xml;q=0.5, application/json",
+			wantStatus: 200,
+			wantType:   "application/json",
+			wantBody:   `{"id":"123"}`,
+		},
+		{
+			name:       "wildcard",
+			accept:     "text/*, application/json;q=0.1",
+			wantStatus: 200,
+			wantType:   "application/json",
+			wantBody:   `{"id":"123"}`,
+		},
+		{
+			name:       "any",
+			accept:     "",
+			wantStatus: 200,
+			wantType:   "application/json",
+			wantBody:   `{"id":"123"}`,
+		},
+		{
+			name:       "not acceptable",
+			accept:     "text/html",
+			wantStatus: http.StatusNotAcceptable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(t)
+			t.Cleanup(s.Close)
+
+			s.On(http.MethodGet, "/test/path").Negotiates(map[string]httptest.Response{
+				"application/json": {Status: 200, Body: []byte(`{"id":"123"}`)},
+				"application/xml":  {Status: 200, Body: []byte("<id>123</id>")},
+			})
+
+			req, err := http.NewRequest(http.MethodGet, s.URL()+"/test/path", nil)
+			require.NoError(t, err)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = res.Body.Close() })
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantType != "" {
+				assert.Equal(t, tt.wantType, res.Header.Get("Content-Type"))
+			}
+			b, _ := ioutil.ReadAll(res.Body)
+			assert.Equal(t, tt.wantBody, string(b))
+		})
+	}
+}
+
+func TestServer_ExpectationReturnsJSONWithContentType(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(e *httptest.Expectation)
+	}{
+		{
+			name: "header before",
+			setup: func(e *httptest.Expectation) {
+				e.Header("Content-Type", "application/problem+json").ReturnsJSON(400, map[string]string{"title": "test"})
+			},
+		},
+		{
+			name: "header after",
+			setup: func(e *httptest.Expectation) {
+				e.ReturnsJSON(400, map[string]string{"title": "test"})
+				e.Header("content-type", "application/problem+json")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(t)
+			t.Cleanup(s.Close)
+			tt.setup(s.On(http.MethodGet, "/test/path"))
+
+			res, err := http.Get(s.URL() + "/test/path")
+			require.NoError(t, err)
+			_ = res.Body.Close()
+
+			assert.Equal(t, 400, res.StatusCode)
+			assert.Equal(t, []string{"application/problem+json"}, res.Header.Values("Content-Type"))
+		})
+	}
+}
+
+func TestServer_ExpectationReturnsJSONHandlesError(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unable to create body for %s: %v", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").ReturnsJSON(200, make(chan int))
+
+	res, err := http.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	assert.Equal(t, 500, res.StatusCode)
+
+	_ = res.Body.Close()
+}
+
+func TestServer_ExpectationReturnsTemplateFile(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").ReturnsTemplateFile(201, "testdata/resp.json.tmpl", struct{ ID string }{ID: "123"})
+
+	res, err := http.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	assert.Equal(t, 201, res.StatusCode)
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(t, `{"id":"123","path":"/test/path"}`+"\n", string(b))
+
+	_ = res.Body.Close()
+}
+
+func TestServer_ExpectationReturnsTemplateFileHandlesError(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unable to render template %s: %v", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").ReturnsTemplateFile(200, "testdata/missing.tmpl", nil)
+
+	res, err := http.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	assert.Equal(t, 500, res.StatusCode)
+
+	_ = res.Body.Close()
+}
+
+func TestServer_ExpectationReturnsFn(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/users/{id}").Times(2).Header("Content-Type", "application/json").
+		ReturnsFn(func(r *http.Request) (int, []byte) {
+			return 201, []byte(`{"id":"` + httptest.PathValue(r, "id") + `"}`)
+		})
+
+	for _, id := range []string{"123", "456"} {
+		res, err := http.Get(s.URL() + "/users/" + id)
+		require.NoError(t, err)
+		b, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+
+		assert.Equal(t, 201, res.StatusCode)
+		assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+		assert.JSONEq(t, `{"id":"`+id+`"}`, string(b))
+	}
+
+	s.AssertExpectations()
+}
+
+func TestServer_ExpectationLastReplyWins(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(e *httptest.Expectation)
+		wantCode int
+		wantBody string
+	}{
+		{
+			name: "seq then string",
+			setup: func(e *httptest.Expectation) {
+				e.ReturnsSeq(503, nil)
+				e.ReturnsString(200, "ok")
+			},
+			wantCode: 200,
+			wantBody: "ok",
+		},
+		{
+			name: "fn then bytes",
+			setup: func(e *httptest.Expectation) {
+				e.ReturnsFn(func(*http.Request) (int, []byte) { return 500, []byte("fn") })
+				e.Returns(200, []byte("ok"))
+			},
+			wantCode: 200,
+			wantBody: "ok",
+		},
+		{
+			name: "failed json then bytes",
+			setup: func(e *httptest.Expectation) {
+				e.ReturnsJSON(200, make(chan int))
+				e.Returns(201, []byte("ok"))
+			},
+			wantCode: 201,
+			wantBody: "ok",
+		},
+		{
+			name: "handler then status",
+			setup: func(e *httptest.Expectation) {
+				e.Handle(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(500) })
+				e.ReturnsStatus(204)
+			},
+			wantCode: 204,
+		},
+		{
+			name: "template then string",
+			setup: func(e *httptest.Expectation) {
+				e.ReturnsTemplateFile(201, "testdata/resp.json.tmpl", struct{ ID string }{ID: "123"})
+				e.ReturnsString(200, "ok")
+			},
+			wantCode: 200,
+			wantBody: "ok",
+		},
+		{
+			name: "negotiate then bytes",
+			setup: func(e *httptest.Expectation) {
+				e.Negotiates(map[string]httptest.Response{"text/plain": {Status: 500, Body: []byte("text")}})
+				e.Returns(200, []byte("ok"))
+			},
+			wantCode: 200,
+			wantBody: "ok",
+		},
+		{
+			name: "reader then string",
+			setup: func(e *httptest.Expectation) {
+				e.ReturnsReader(500, strings.NewReader("reader"), -1)
+				e.ReturnsString(200, "ok")
+			},
+			wantCode: 200,
+			wantBody: "ok",
+		},
+		{
+			name: "string then fn",
+			setup: func(e *httptest.Expectation) {
+				e.ReturnsString(500, "string")
+				e.ReturnsFn(func(*http.Request) (int, []byte) { return 200, []byte("ok") })
+			},
+			wantCode: 200,
+			wantBody: "ok",
+		},
+		{
+			name: "string then seq",
+			setup: func(e *httptest.Expectation) {
+				e.ReturnsString(500, "string")
+				e.ReturnsSeq(200, []byte("ok"))
+			},
+			wantCode: 200,
+			wantBody: "ok",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockT := newMockT()
+
+			s := httptest.NewServer(mockT)
+			t.Cleanup(s.Close)
+			tt.setup(s.On(http.MethodGet, "/test/path"))
+
+			res, err := http.Get(s.URL() + "/test/path")
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = res.Body.Close() })
+
+			b, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+			assert.Equal(t, tt.wantBody, string(b))
+			mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestServer_ExpectationReturnsStatusCode(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").ReturnsStatus(400)
+
+	res, err := http.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	assert.Equal(t, 400, res.StatusCode)
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.Len(t, b, 0)
+
+	_ = res.Body.Close()
+}
+
+func TestServer_ExpectationReturnsHeaders(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").Header("foo", "bar").ReturnsStatus(200)
+
+	res, err := http.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	v := res.Header.Get("foo")
+	assert.Equal(t, "bar", v)
+
+	_ = res.Body.Close()
+}
+
+func TestServer_ExpectationRun(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	var keys []string
+	s.On(http.MethodPost, "/test/path").Times(2).Run(func(r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		keys = append(keys, r.Header.Get("Idempotency-Key")+":"+string(b))
+	}).ReturnsString(201, "test")
+
+	for _, key := range []string{"a", "b"} {
+		req, err := http.NewRequest(http.MethodPost, s.URL()+"/test/path", strings.NewReader("body"))
+		require.NoError(t, err)
+		req.Header.Set("Idempotency-Key", key)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		b, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+
+		assert.Equal(t, 201, res.StatusCode)
+		assert.Equal(t, "test", string(b))
+	}
+
+	assert.Equal(t, []string{"a:body", "b:body"}, keys)
+	s.AssertExpectations()
+}
+
+func TestServer_ExpectationNotify(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	exp := s.On(http.MethodPost, "/test/path")
+	ch := exp.Notify()
+
+	go func() {
+		for _, body := range []string{"a", "b"} {
+			res, err := http.Post(s.URL()+"/test/path", "text/plain", strings.NewReader(body))
+			if err == nil {
+				_ = res.Body.Close()
+			}
+		}
+	}()
+
+	for _, want := range []string{"a", "b"} {
+		select {
+		case req := <-ch:
+			b, _ := io.ReadAll(req.Body)
+			assert.Equal(t, want, string(b))
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for request")
+		}
+	}
+}
+
+func TestServer_ExpectationNotifyClosedOnClose(t *testing.T) {
+	s := httptest.NewServer(t)
+
+	ch := s.On(http.MethodGet, "/test/path").Notify()
+	s.Close()
+
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for channel to close")
+	}
+}
+
+func TestServer_ExpectationUsesHandleFunc(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").Handle(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+	})
+
+	res, err := http.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	assert.Equal(t, 400, res.StatusCode)
+}
+
+func TestServer_ExpectationDelayHeader(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").DelayHeader(100*time.Millisecond).ReturnsString(200, "test")
+
+	c := &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: 10 * time.Millisecond}}
+	_, err := c.Get(s.URL() + "/test/path")
+
+	assert.Error(t, err)
+}
+
+func TestServer_ExpectationDelayBody(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").DelayBody(100*time.Millisecond).ReturnsString(200, "test")
+
+	c := &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: 50 * time.Millisecond}}
+	start := time.Now()
+	res, err := c.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = res.Body.Close() })
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	b, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "test", string(b))
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestServer_ExpectationDropsConnection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	s := httptest.NewServer(t, httptest.WithJournal(path))
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").DropsConnection()
+
+	_, err := http.Get(s.URL() + "/test/path")
+
+	assert.Error(t, err)
+	s.AssertExpectations()
+	s.Close()
+	entries := readJournal(t, path)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 0, entries[0].Status)
+}
+
+func TestServer_ExpectationHangs(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").Hangs()
+
+	c := &http.Client{Timeout: 50 * time.Millisecond}
+	_, err := c.Get(s.URL() + "/test/path")
+
+	assert.Error(t, err)
+	s.AssertExpectations()
+}
+
+func TestServer_ExpectationHangsReleasedOnClose(t *testing.T) {
+	s := httptest.NewServer(t)
+
+	s.On(http.MethodGet, "/test/path").Hangs()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := http.Get(s.URL() + "/test/path")
+		errCh <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	s.Close()
+
+	assert.Error(t, <-errCh)
+}
+
+func TestServer_ExpectationMaxConcurrent(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").MaxConcurrent(2).Handle(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	})
+
+	doConcurrentGets(t, s.URL()+"/test/path", 2)
+}
+
+func TestServer_ExpectationMaxConcurrentExceeded(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() {
+		mockT.AssertCalled(t, "Errorf", "Expected at most %d concurrent calls to %s but got %d", mock.Anything)
+	})
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").MaxConcurrent(2).Handle(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	})
+
+	doConcurrentGets(t, s.URL()+"/test/path", 4)
+}
+
+func TestServer_ExpectationMaxConcurrentSetDuringRequests(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	exp := s.On(http.MethodGet, "/test/path")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 50; i++ {
+			exp.MaxConcurrent(100)
+		}
+	}()
+	doConcurrentGets(t, s.URL()+"/test/path", 20)
+	<-done
+}
+
+func TestServer_Requests(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	exp := s.On(http.MethodPost, "/test/path")
+	s.On(http.MethodGet, httptest.Anything)
+
+	req, err := http.NewRequest(http.MethodPost, s.URL()+"/test/path?a=b", strings.NewReader("test body"))
+	require.NoError(t, err)
+	req.Header.Set("X-Request-ID", "123")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	doGet(t, s.URL()+"/other")
+
+	reqs := s.Requests()
+	require.Len(t, reqs, 2)
+	assert.Equal(t, http.MethodPost, reqs[0].Method)
+	assert.Equal(t, "/test/path", reqs[0].URL.Path)
+	assert.Equal(t, "b", reqs[0].URL.Query().Get("a"))
+	assert.Equal(t, "123", reqs[0].Header.Get("X-Request-ID"))
+	assert.Equal(t, []byte("test body"), reqs[0].Body)
+	assert.Equal(t, []byte("test body"), reqs[0].RawBody)
+	assert.Equal(t, http.MethodGet, reqs[1].Method)
+	assert.Equal(t, "/other", reqs[1].URL.Path)
+
+	expReqs := exp.Requests()
+	require.Len(t, expReqs, 1)
+	assert.Equal(t, reqs[0], expReqs[0])
+}
+
+func TestServer_WaitForRequests(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path")
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			time.Sleep(10 * time.Millisecond)
+			res, err := http.Get(s.URL() + "/test/path")
+			if err == nil {
+				_ = res.Body.Close()
+			}
+		}
+	}()
+
+	s.WaitForRequests(3, time.Second)
+
+	assert.Len(t, s.Requests(), 3)
+}
+
+func TestServer_WaitForRequestsTimesOut(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Expected %d requests within %s but got %d", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+
+	doGet(t, s.URL()+"/test/path")
+
+	s.WaitForRequests(2, 50*time.Millisecond)
+}
+
+func TestServer_ExpectationWait(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	exp := s.On(http.MethodGet, "/test/path")
+	s.On(http.MethodGet, "/other")
+
+	go func() {
+		for _, path := range []string{"/other", "/test/path", "/other", "/test/path"} {
+			time.Sleep(10 * time.Millisecond)
+			res, err := http.Get(s.URL() + path)
+			if err == nil {
+				_ = res.Body.Close()
+			}
+		}
+	}()
+
+	exp.Wait(2, time.Second)
+
+	assert.Len(t, exp.Requests(), 2)
+}
+
+func TestServer_ExpectationWaitTimesOut(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Expected %d calls to %s within %s but got %d", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+
+	exp := s.On(http.MethodGet, "/test/path")
+
+	exp.Wait(1, 50*time.Millisecond)
+}
+
+func TestServer_AssertDeadlinePropagated(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []httptest.OptFunc
+		header  string
+		value   string
+		wantErr string
+	}{
+		{
+			name:   "milliseconds",
+			header: httptest.DefaultDeadlineHeader,
+			value:  "1500",
+		},
+		{
+			name:   "duration",
+			header: httptest.DefaultDeadlineHeader,
+			value:  "1.5s",
+		},
+		{
+			name:   "custom header",
+			opts:   []httptest.OptFunc{httptest.WithDeadlineHeader("Request-Timeout")},
+			header: "Request-Timeout",
+			value:  "1500",
+		},
+		{
+			name:    "out of bounds",
+			header:  httptest.DefaultDeadlineHeader,
+			value:   "5s",
+			wantErr: "Expected %s %s to propagate a deadline between %s and %s but got %s",
+		},
+		{
+			name:    "missing",
+			header:  "Other",
+			value:   "1s",
+			wantErr: "Expected %s %s to propagate a deadline but got none",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockT := newMockT()
+
+			s := httptest.NewServer(mockT, tt.opts...)
+			t.Cleanup(s.Close)
+			s.On(http.MethodGet, "/test/path")
+
+			req, err := http.NewRequest(http.MethodGet, s.URL()+"/test/path", nil)
+			require.NoError(t, err)
+			req.Header.Set(tt.header, tt.value)
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			_ = res.Body.Close()
+
+			s.AssertDeadlinePropagated(time.Second, 2*time.Second)
+
+			if tt.wantErr != "" {
+				mockT.AssertCalled(t, "Errorf", tt.wantErr, mock.Anything)
+			} else {
+				mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestServer_AssertCalled(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	exp := s.On(http.MethodGet, "/users/{id}")
+	s.On(http.MethodPost, httptest.Anything)
+
+	doGet(t, s.URL()+"/users/123")
+	doGet(t, s.URL()+"/users/456")
+
+	s.AssertCalled(http.MethodGet, "/users/123")
+	s.AssertCalled(http.MethodGet, "/users/*")
+	s.AssertCalled(httptest.Anything, httptest.Anything)
+	s.AssertNotCalled(http.MethodPost, httptest.Anything)
+	s.AssertNumberOfCalls(http.MethodGet, "/users/{id}", 2)
+	assert.Equal(t, 2, exp.CallCount())
+}
+
+func TestServer_AssertCalledFails(t *testing.T) {
+	tests := []struct {
+		name    string
+		assert  func(s *httptest.Server)
+		wantErr string
+	}{
+		{
+			name:    "called",
+			assert:  func(s *httptest.Server) { s.AssertCalled(http.MethodPost, "/test/path") },
+			wantErr: "Expected a call to %s %s but got none",
+		},
+		{
+			name:    "not called",
+			assert:  func(s *httptest.Server) { s.AssertNotCalled(http.MethodGet, "/test/path") },
+			wantErr: "Expected no calls to %s %s but got called %d times",
+		},
+		{
+			name:    "number of calls",
+			assert:  func(s *httptest.Server) { s.AssertNumberOfCalls(http.MethodGet, "/test/path", 2) },
+			wantErr: "Expected a call to %s %s %d times but got called %d times",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockT := newMockT()
+
+			s := httptest.NewServer(mockT)
+			t.Cleanup(s.Close)
+			s.On(http.MethodGet, "/test/path")
+
+			doGet(t, s.URL()+"/test/path")
+			tt.assert(s)
+
+			mockT.AssertCalled(t, "Errorf", tt.wantErr, mock.Anything)
+		})
+	}
+}
+
+func TestServer_AssertQuiet(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodGet, "/test/path")
+
+	doGet(t, s.URL()+"/test/path")
+
+	s.AssertQuiet(50 * time.Millisecond)
+}
+
+func TestServer_AssertQuietWithRequests(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Expected no calls for %s but got %d", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodGet, "/test/path")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		doGet(t, s.URL()+"/test/path")
+	}()
+
+	s.AssertQuiet(50 * time.Millisecond)
+}
+
+func TestServer_AssertExpectationsAtLeast(t *testing.T) {
+	tests := []struct {
+		name    string
+		calls   int
+		wantErr bool
+	}{
+		{
+			name:    "too few",
+			calls:   1,
+			wantErr: true,
+		},
+		{
+			name:    "minimum",
+			calls:   2,
+			wantErr: false,
+		},
+		{
+			name:    "more",
+			calls:   4,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockT := newMockT()
+
+			s := httptest.NewServer(mockT)
+			t.Cleanup(s.Close)
+			s.On(http.MethodGet, "/test/path").AtLeast(2)
+
+			for i := 0; i < tt.calls; i++ {
+				doGet(t, s.URL()+"/test/path")
+			}
+			s.AssertExpectations()
+
+			if tt.wantErr {
+				mockT.AssertCalled(t, "Errorf", "Expected a call to %s at least %d times but got called %d times", mock.Anything)
+			} else {
+				mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestServer_AssertExpectationsAtMost(t *testing.T) {
+	tests := []struct {
+		name    string
+		calls   int
+		wantErr bool
+	}{
+		{
+			name:    "none",
+			calls:   0,
+			wantErr: false,
+		},
+		{
+			name:    "maximum",
+			calls:   2,
+			wantErr: false,
+		},
+		{
+			name:    "too many",
+			calls:   3,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockT := newMockT()
+
+			s := httptest.NewServer(mockT)
+			t.Cleanup(s.Close)
+			s.On(http.MethodGet, "/test/path").AtMost(2)
+
+			for i := 0; i < tt.calls; i++ {
+				doGet(t, s.URL()+"/test/path")
+			}
+			s.AssertExpectations()
+
+			if tt.wantErr {
+				mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything)
+			} else {
+				mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestServer_AssertExpectationsAtLeastAtMost(t *testing.T) {
+	mockT := newMockT()
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodGet, "/test/path").AtLeast(2).AtMost(3)
+
+	doGet(t, s.URL()+"/test/path")
+	s.AssertExpectations()
+
+	mockT.AssertCalled(t, "Errorf", "Expected a call to %s at least %d times but got called %d times", mock.Anything)
+}
+
+func TestServer_AssertExpectationsMaybe(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls int
+	}{
+		{
+			name:  "none",
+			calls: 0,
+		},
+		{
+			name:  "called",
+			calls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockT := newMockT()
+
+			s := httptest.NewServer(mockT)
+			t.Cleanup(s.Close)
+			s.On(http.MethodGet, "/health").Maybe()
+
+			for i := 0; i < tt.calls; i++ {
+				doGet(t, s.URL()+"/health")
+			}
+			s.AssertExpectations()
+
+			mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestServer_NotOn(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.NotOn(http.MethodPost, "/upstream")
+	s.On(httptest.Anything, httptest.Anything)
+
+	doGet(t, s.URL()+"/upstream")
+	s.AssertExpectations()
+}
+
+func TestServer_NotOnCalled(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Expected no calls to %s but got %s %s", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(httptest.Anything, httptest.Anything)
+	exp := s.On(http.MethodPost, "/upstream").Never()
+
+	res, err := http.Post(s.URL()+"/upstream", "text/plain", nil)
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	assert.Equal(t, 1, exp.CallCount())
+}
+
+func TestServer_InOrder(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+
+	s.InOrder()
+	s.On(http.MethodPost, "/items").Times(1)
+	s.On(http.MethodGet, "/items/1").Times(2)
+	s.On(http.MethodDelete, "/items/1").Times(1)
+
+	doRequest(t, http.MethodPost, s.URL()+"/items")
+	doRequest(t, http.MethodGet, s.URL()+"/items/1")
+	doRequest(t, http.MethodGet, s.URL()+"/items/1")
+	doRequest(t, http.MethodDelete, s.URL()+"/items/1")
+
+	s.AssertExpectations()
+}
+
+func TestServer_InOrderOutOfOrder(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+
+	s.InOrder()
+	s.On(http.MethodPost, "/items").Times(1)
+	s.On(http.MethodGet, "/items/1").Times(2)
+
+	doRequest(t, http.MethodPost, s.URL()+"/items")
+	doRequest(t, http.MethodGet, s.URL()+"/items/1")
+	doRequest(t, http.MethodGet, s.URL()+"/items/1")
+	doRequest(t, http.MethodPost, s.URL()+"/items")
+}
+
+func TestServer_ExpectationAfter(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Expected a call to %s before %s %s", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+
+	create := s.On(http.MethodPost, "/items")
+	s.On(http.MethodGet, "/items/1").After(create)
+
+	doRequest(t, http.MethodGet, s.URL()+"/items/1")
+}
+
+func TestServer_AssertExpectations(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertNotCalled(t, "Errorf", mock.Anything, mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodGet, "/").Times(1)
+
+	_, err := http.Get(s.URL() + "/")
+	assert.NoError(t, err)
+
+	s.AssertExpectations()
+}
+
+func TestServer_AssertExpectationsOnUnlimited(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Expected a call to %s but got none", mock.Anything) })
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodPost, "/")
+
+	s.AssertExpectations()
+}
+
+func TestServer_AssertExpectationsOnNTimes(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() {
+		mockT.AssertCalled(t, "Errorf", "Expected a call to %s %d times but got called %d times", mock.Anything)
+	})
+
+	s := httptest.NewServer(mockT)
+	t.Cleanup(s.Close)
+	s.On(http.MethodPost, "/").Times(1)
+
+	s.AssertExpectations()
+}
+
+func TestServer_ClosesOnCleanup(t *testing.T) {
+	var url string
+	t.Run("test", func(t *testing.T) {
+		s := httptest.NewServer(t)
+		s.On(http.MethodGet, "/test/path")
+
+		url = s.URL()
+		doRequest(t, http.MethodGet, url+"/test/path")
+	})
+
+	_, err := http.Get(url + "/test/path")
+	assert.Error(t, err)
+}
+
+func TestServer_WithAutoAssert(t *testing.T) {
+	mockT := new(MockTestingT)
+	var cleanup func()
+	mockT.On("Cleanup", mock.Anything).Run(func(args mock.Arguments) {
+		cleanup = args.Get(0).(func())
+	}).Once()
+	mockT.On("Errorf", "Expected a call to %s but got none", mock.Anything).Once()
+
+	s := httptest.NewServer(mockT, httptest.WithAutoAssert())
+	s.On(http.MethodGet, "/test/path")
+
+	cleanup()
+
+	mockT.AssertExpectations(t)
+	_, err := http.Get(s.URL() + "/test/path")
+	assert.Error(t, err)
+}
+
+func TestServer_WithoutAutoClose(t *testing.T) {
+	var s *httptest.Server
+	t.Run("test", func(t *testing.T) {
+		s = httptest.NewServer(t, httptest.WithoutAutoClose())
+	})
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path")
+
+	doRequest(t, http.MethodGet, s.URL()+"/test/path")
+}
+
+func TestServer_ConcurrentExpectationsAndRequests(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").Maybe()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+
+			path := "/test/" + strconv.Itoa(i)
+			s.On(http.MethodPost, path).MatchHeader("X-Test", "yes").Times(5).ReturnsStatus(http.StatusCreated)
+			for j := 0; j < 5; j++ {
+				req, _ := http.NewRequest(http.MethodPost, s.URL()+path, nil)
+				req.Header.Set("X-Test", "yes")
+				res, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_ = res.Body.Close()
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+
+			doConcurrentGets(t, s.URL()+"/test/path", 5)
+		}()
+	}
+	wg.Wait()
+
+	s.AssertExpectations()
+	assert.Len(t, s.Requests(), 200)
+	s.AssertNumberOfCalls(http.MethodGet, "/test/path", 100)
+}
+
+func TestServer_ConfiguresExpectationDuringRequests(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	exp := s.On(http.MethodGet, "/test/path")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 50; i++ {
+			exp.Header("X-Test", "yes").DelayHeader(0).ReturnsString(200, "test")
+		}
+	}()
+	doConcurrentGets(t, s.URL()+"/test/path", 20)
+	<-done
+
+	s.AssertExpectations()
+}
+
+func doContinueRequest(t *testing.T, url string) (*http.Response, error) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPut, url, strings.NewReader("test body"))
+	require.NoError(t, err)
+	req.Header.Set("Expect", "100-continue")
+
+	c := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+	return c.Do(req)
+}
+
+func doConcurrentGets(t *testing.T, url string, n int) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res, err := http.Get(url)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = res.Body.Close()
+		}()
+	}
+	wg.Wait()
+}
+
+func doRequest(t *testing.T, method, url string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = res.Body.Close()
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+type MockTestingT struct {
+	mock.Mock
+
+	logMu sync.Mutex
+	logs  []string
+}
+
+// newMockT returns a mock T accepting any errors and cleanups.
+func newMockT() *MockTestingT {
+	mockT := new(MockTestingT)
+	mockT.On("Errorf", mock.Anything, mock.Anything).Maybe()
+	mockT.On("Cleanup", mock.Anything).Maybe()
+	return mockT
+}
+
+func (m *MockTestingT) Helper() {}
+
+func (m *MockTestingT) Errorf(format string, args ...interface{}) {
+	m.Called(format, fmt.Sprint(args...))
+}
+
+func (m *MockTestingT) Cleanup(fn func()) {
+	m.Called(fn)
+}
+
+func (m *MockTestingT) Logf(format string, args ...interface{}) {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+
+	m.logs = append(m.logs, fmt.Sprintf(format, args...))
+}
+
+// Logs returns the logged lines.
+func (m *MockTestingT) Logs() []string {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+
+	return append([]string(nil), m.logs...)
 }
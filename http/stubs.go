@@ -0,0 +1,27 @@
+package http
+
+// StubFunc sets up expectations on a server.
+type StubFunc func(s *Server)
+
+// StubSet is a reusable set of expectations that can be installed on any server.
+//
+//	var AuthStubs = httptest.Stubs(
+//		func(s *httptest.Server) {
+//			s.On(http.MethodPost, "/oauth/token").Maybe().ReturnsJSON(http.StatusOK, token)
+//		},
+//	)
+type StubSet []StubFunc
+
+// Stubs returns a stub set of the given functions.
+func Stubs(fns ...StubFunc) StubSet {
+	return fns
+}
+
+// Install sets up the expectations of the stub sets on the server.
+func (s *Server) Install(sets ...StubSet) {
+	for _, set := range sets {
+		for _, fn := range set {
+			fn(s)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package http_test
+
+import (
+	"net/http"
+	"testing"
+
+	httptest "github.com/hamba/testutils/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	authStubs = httptest.Stubs(
+		func(s *httptest.Server) {
+			s.On(http.MethodPost, "/oauth/token").Maybe().ReturnsString(200, "token")
+		},
+	)
+	healthStubs = httptest.Stubs(
+		func(s *httptest.Server) {
+			s.On(http.MethodGet, "/health").Maybe().ReturnsStatus(http.StatusNoContent)
+		},
+	)
+)
+
+func TestServer_Install(t *testing.T) {
+	tests := []struct {
+		name string
+	}{
+		{name: "first"},
+		{name: "second"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(t)
+			t.Cleanup(s.Close)
+
+			s.Install(authStubs, healthStubs)
+
+			res, err := http.Post(s.URL()+"/oauth/token", "text/plain", nil)
+			require.NoError(t, err)
+			_ = res.Body.Close()
+			assert.Equal(t, 200, res.StatusCode)
+
+			res, err = http.Get(s.URL() + "/health")
+			require.NoError(t, err)
+			_ = res.Body.Close()
+			assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+			s.AssertExpectations()
+		})
+	}
+}
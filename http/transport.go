@@ -0,0 +1,108 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+)
+
+// roundTripURL is the url of servers without a listener.
+const roundTripURL = "http://roundtripper"
+
+// errConnectionDropped is returned by the transport when the server drops the connection.
+var errConnectionDropped = errors.New("httptest: connection dropped")
+
+// NewRoundTripper creates a new mock http server without a listener.
+// Requests are served in process through the server Transport or Client,
+// for any url, and the server URL is only a placeholder.
+func NewRoundTripper(t TestingT, opts ...OptFunc) *Server {
+	t.Helper()
+
+	srv := &Server{
+		t:              t,
+		deadlineHeader: DefaultDeadlineHeader,
+		done:           make(chan struct{}),
+		noListener:     true,
+	}
+	srv.srv = &httptest.Server{
+		URL:    roundTripURL,
+		Config: &http.Server{Handler: http.HandlerFunc(srv.handler)},
+	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+	t.Cleanup(srv.cleanup)
+
+	return srv
+}
+
+// Transport returns a round tripper that serves requests in process,
+// without making a network connection to the server.
+func (s *Server) Transport() http.RoundTripper {
+	return roundTripperFunc(s.roundTrip)
+}
+
+func (s *Server) roundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer func() { _ = req.Body.Close() }()
+	}
+
+	sreq := req.Clone(req.Context())
+	sreq.RequestURI = req.URL.RequestURI()
+	sreq.RemoteAddr = "127.0.0.1:0"
+	if sreq.Host == "" {
+		sreq.Host = req.URL.Host
+	}
+	if sreq.Body == nil {
+		sreq.Body = http.NoBody
+	}
+
+	w := &roundTripWriter{ResponseRecorder: httptest.NewRecorder()}
+	if p := s.serveRoundTrip(w, sreq); p != nil {
+		return nil, fmt.Errorf("httptest: handler panicked: %v", p)
+	}
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	if w.dropped {
+		return nil, errConnectionDropped
+	}
+
+	res := w.Result()
+	res.Request = req
+	return res, nil
+}
+
+// serveRoundTrip serves the request, recovering a handler panic
+// as the http server would.
+func (s *Server) serveRoundTrip(w http.ResponseWriter, req *http.Request) (p interface{}) {
+	defer func() { p = recover() }()
+
+	s.srv.Config.Handler.ServeHTTP(w, req)
+	return nil
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+// roundTripWriter records the response, emulating a hijacked connection.
+type roundTripWriter struct {
+	*httptest.ResponseRecorder
+
+	dropped bool
+}
+
+func (w *roundTripWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.dropped = true
+
+	conn, peer := net.Pipe()
+	_ = peer.Close()
+	return conn, bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)), nil
+}
@@ -0,0 +1,149 @@
+package http_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	httptest "github.com/hamba/testutils/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTripper(t *testing.T) {
+	s := httptest.NewRoundTripper(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodPost, "/test/path").Header("X-Test", "yes").ReturnsString(201, "test")
+
+	c := &http.Client{Transport: s.Transport()}
+	res, err := c.Post("http://example.com/test/path?a=b", "text/plain", strings.NewReader("test body"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = res.Body.Close() })
+
+	assert.Equal(t, 201, res.StatusCode)
+	assert.Equal(t, "yes", res.Header.Get("X-Test"))
+	b, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "test", string(b))
+	s.AssertExpectations()
+
+	reqs := s.Requests()
+	require.Len(t, reqs, 1)
+	assert.Equal(t, "b", reqs[0].URL.Query().Get("a"))
+	assert.Equal(t, []byte("test body"), reqs[0].Body)
+}
+
+func TestRoundTripper_ClosesRequestBody(t *testing.T) {
+	s := httptest.NewRoundTripper(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodPost, "/test/path").ReturnsStatus(200)
+	s.On(http.MethodPost, "/dropped").DropsConnection()
+
+	for _, path := range []string{"/test/path", "/dropped"} {
+		body := &closeRecorder{Reader: strings.NewReader("test body")}
+		req, err := http.NewRequest(http.MethodPost, "http://example.com"+path, body)
+		require.NoError(t, err)
+
+		res, err := s.Transport().RoundTrip(req)
+		if err == nil {
+			_ = res.Body.Close()
+		}
+
+		assert.True(t, body.closed, path)
+	}
+}
+
+func TestRoundTripper_Client(t *testing.T) {
+	s := httptest.NewRoundTripper(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path")
+
+	res, err := s.Client().Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	assert.Equal(t, 200, res.StatusCode)
+}
+
+func TestRoundTripper_DropsConnection(t *testing.T) {
+	s := httptest.NewRoundTripper(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").DropsConnection()
+
+	_, err := s.Client().Get(s.URL() + "/test/path")
+
+	assert.Error(t, err)
+}
+
+func TestRoundTripper_HangsUntilDeadline(t *testing.T) {
+	s := httptest.NewRoundTripper(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").Hangs()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL()+"/test/path", nil)
+	require.NoError(t, err)
+
+	_, err = s.Client().Do(req)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRoundTripper_WithUnmatchedPanic(t *testing.T) {
+	s := httptest.NewRoundTripper(t, httptest.WithUnmatched(httptest.UnmatchedPanic))
+	t.Cleanup(s.Close)
+
+	var err error
+	assert.NotPanics(t, func() {
+		_, err = s.Client().Get(s.URL() + "/test/path")
+	})
+
+	assert.Error(t, err)
+}
+
+func TestRoundTripper_HandlesUnexpectedRequest(t *testing.T) {
+	mockT := newMockT()
+	t.Cleanup(func() { mockT.AssertCalled(t, "Errorf", "Unexpected call to %s %s", mock.Anything) })
+
+	s := httptest.NewRoundTripper(mockT)
+	t.Cleanup(s.Close)
+
+	res, err := s.Client().Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+}
+
+func TestServer_Transport(t *testing.T) {
+	s := httptest.NewServer(t)
+	t.Cleanup(s.Close)
+
+	s.On(http.MethodGet, "/test/path").ReturnsString(200, "test")
+
+	c := &http.Client{Transport: s.Transport()}
+	res, err := c.Get(s.URL() + "/test/path")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	assert.Equal(t, 200, res.StatusCode)
+	s.AssertExpectations()
+}
+
+type closeRecorder struct {
+	io.Reader
+
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
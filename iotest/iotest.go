@@ -0,0 +1,159 @@
+/*
+Package iotest provides readers and writers that fail in controlled ways.
+
+They allow IO error paths to be tested without hand-written stubs:
+
+	func TestDecode_HandlesReadError(t *testing.T) {
+		r := iotest.ErrReaderAfter(strings.NewReader(payload), 10, io.ErrUnexpectedEOF)
+
+		_, err := Decode(r)
+
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	}
+*/
+package iotest
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrFlaky is returned by flaky readers and writers on a simulated failure.
+var ErrFlaky = errors.New("iotest: flaky failure")
+
+type errReaderAfter struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+// ErrReaderAfter returns a reader that reads at most n bytes from r
+// and then returns err.
+func ErrReaderAfter(r io.Reader, n int64, err error) io.Reader {
+	return &errReaderAfter{r: r, n: n, err: err}
+}
+
+func (r *errReaderAfter) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, r.err
+	}
+
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.r.Read(p)
+	r.n -= int64(n)
+	if err == nil && r.n <= 0 {
+		err = r.err
+	}
+	return n, err
+}
+
+type shortWriter struct {
+	w io.Writer
+	n int
+}
+
+// ShortWriter returns a writer that writes at most n bytes of each write to w,
+// returning io.ErrShortWrite when a write is truncated.
+func ShortWriter(w io.Writer, n int) io.Writer {
+	return &shortWriter{w: w, n: n}
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) <= w.n {
+		return w.w.Write(p)
+	}
+
+	n, err := w.w.Write(p[:w.n])
+	if err != nil {
+		return n, err
+	}
+	return n, io.ErrShortWrite
+}
+
+type slowReader struct {
+	r   io.Reader
+	bps int
+}
+
+// SlowReader returns a reader that reads from r at roughly the given bytes per second.
+func SlowReader(r io.Reader, bytesPerSec int) io.Reader {
+	return &slowReader{r: r, bps: bytesPerSec}
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if r.bps <= 0 {
+		return r.r.Read(p)
+	}
+
+	// Read in chunks of at most a tenth of a second.
+	if chunk := r.bps / 10; chunk > 0 && len(p) > chunk {
+		p = p[:chunk]
+	}
+
+	start := time.Now()
+	n, err := r.r.Read(p)
+	if n > 0 {
+		d := time.Duration(n) * time.Second / time.Duration(r.bps)
+		time.Sleep(d - time.Since(start))
+	}
+	return n, err
+}
+
+type flakyReadWriter struct {
+	rw io.ReadWriter
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// FlakyReadWriter returns a read writer that randomly fails with ErrFlaky or
+// performs short reads and writes on rw. The failures are deterministic for a given seed.
+func FlakyReadWriter(rw io.ReadWriter, seed int64) io.ReadWriter {
+	return &flakyReadWriter{
+		rw:  rw,
+		rnd: rand.New(rand.NewSource(seed)), //nolint:gosec // Deterministic randomness is intended.
+	}
+}
+
+// next returns if the operation should fail, and the length
+// of the buffer to use.
+func (f *flakyReadWriter) next(l int) (bool, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch f.rnd.Intn(4) {
+	case 0:
+		return true, 0
+	case 1:
+		if l > 1 {
+			return false, 1 + f.rnd.Intn(l-1)
+		}
+	}
+	return false, l
+}
+
+func (f *flakyReadWriter) Read(p []byte) (int, error) {
+	fail, l := f.next(len(p))
+	if fail {
+		return 0, ErrFlaky
+	}
+	return f.rw.Read(p[:l])
+}
+
+func (f *flakyReadWriter) Write(p []byte) (int, error) {
+	fail, l := f.next(len(p))
+	if fail {
+		return 0, ErrFlaky
+	}
+
+	n, err := f.rw.Write(p[:l])
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
@@ -0,0 +1,103 @@
+package iotest_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hamba/testutils/iotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrReaderAfter(t *testing.T) {
+	wantErr := errors.New("test")
+	r := iotest.ErrReaderAfter(strings.NewReader("0123456789"), 4, wantErr)
+
+	got, err := io.ReadAll(r)
+
+	assert.ErrorIs(t, err, wantErr)
+	assert.Equal(t, "0123", string(got))
+}
+
+func TestErrReaderAfter_HandlesShortReader(t *testing.T) {
+	r := iotest.ErrReaderAfter(strings.NewReader("01"), 4, errors.New("test"))
+
+	got, err := io.ReadAll(r)
+
+	require.NoError(t, err)
+	assert.Equal(t, "01", string(got))
+}
+
+func TestShortWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := iotest.ShortWriter(&buf, 3)
+
+	n, err := w.Write([]byte("ab"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	n, err = w.Write([]byte("cdefg"))
+	assert.ErrorIs(t, err, io.ErrShortWrite)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, "abcde", buf.String())
+}
+
+func TestSlowReader(t *testing.T) {
+	r := iotest.SlowReader(bytes.NewReader(make([]byte, 200)), 1000)
+
+	start := time.Now()
+	got, err := io.ReadAll(r)
+	dur := time.Since(start)
+
+	require.NoError(t, err)
+	assert.Len(t, got, 200)
+	assert.InDelta(t, 200*time.Millisecond, dur, float64(50*time.Millisecond))
+}
+
+func TestFlakyReadWriter(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 10))
+
+	var buf bytes.Buffer
+	rw := iotest.FlakyReadWriter(&buf, 1)
+
+	var written, failures int
+	for written < len(data) {
+		n, err := rw.Write(data[written:])
+		written += n
+		if errors.Is(err, iotest.ErrFlaky) {
+			failures++
+		}
+	}
+
+	var read []byte
+	p := make([]byte, 16)
+	for len(read) < len(data) {
+		n, err := rw.Read(p)
+		read = append(read, p[:n]...)
+		if errors.Is(err, iotest.ErrFlaky) {
+			failures++
+		}
+	}
+
+	assert.Equal(t, data, read)
+	assert.NotZero(t, failures)
+}
+
+func TestFlakyReadWriter_IsDeterministic(t *testing.T) {
+	run := func() []error {
+		rw := iotest.FlakyReadWriter(&bytes.Buffer{}, 42)
+
+		var errs []error
+		for i := 0; i < 20; i++ {
+			_, err := rw.Write([]byte("test"))
+			errs = append(errs, err)
+		}
+		return errs
+	}
+
+	assert.Equal(t, run(), run())
+}
@@ -0,0 +1,224 @@
+package iotest
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const defaultPipeBufferSize = 64 * 1024
+
+type pipeConfig struct {
+	bufSize   int
+	latency   time.Duration
+	failAfter int64
+	failErr   error
+}
+
+// PipeOptFunc configures a pipe.
+type PipeOptFunc func(*pipeConfig)
+
+// WithBufferSize sets the number of bytes that can be buffered in each
+// direction before writes block.
+func WithBufferSize(n int) PipeOptFunc {
+	return func(c *pipeConfig) {
+		c.bufSize = n
+	}
+}
+
+// WithLatency sets the delay before written bytes can be read.
+func WithLatency(d time.Duration) PipeOptFunc {
+	return func(c *pipeConfig) {
+		c.latency = d
+	}
+}
+
+// WithFailAfter fails writes with err once n bytes have been written in a direction.
+func WithFailAfter(n int64, err error) PipeOptFunc {
+	return func(c *pipeConfig) {
+		c.failAfter = n
+		c.failErr = err
+	}
+}
+
+// PipeEnd is one end of an in-memory duplex pipe.
+type PipeEnd struct {
+	r *halfPipe
+	w *halfPipe
+}
+
+// Pipe creates an in-memory duplex pipe with bounded buffers, returning both ends.
+// Data written to one end can be read from the other.
+func Pipe(opts ...PipeOptFunc) (*PipeEnd, *PipeEnd) {
+	cfg := pipeConfig{bufSize: defaultPipeBufferSize}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.bufSize <= 0 {
+		cfg.bufSize = 1
+	}
+
+	ab, ba := newHalfPipe(cfg), newHalfPipe(cfg)
+	return &PipeEnd{r: ba, w: ab}, &PipeEnd{r: ab, w: ba}
+}
+
+// Read reads data written to the other end of the pipe.
+func (e *PipeEnd) Read(p []byte) (int, error) {
+	return e.r.read(p)
+}
+
+// Write writes data to be read from the other end of the pipe,
+// blocking while the buffer is full.
+func (e *PipeEnd) Write(p []byte) (int, error) {
+	return e.w.write(p)
+}
+
+// Close closes the pipe end. Reads on the other end return io.EOF
+// once the buffer is drained, and writes return io.ErrClosedPipe.
+func (e *PipeEnd) Close() error {
+	e.w.closeWrite(io.EOF)
+	e.r.closeRead()
+	return nil
+}
+
+// Fail causes all further reads and writes on both ends of the pipe to return err.
+func (e *PipeEnd) Fail(err error) {
+	e.r.fail(err)
+	e.w.fail(err)
+}
+
+type chunk struct {
+	data  []byte
+	ready time.Time
+}
+
+type halfPipe struct {
+	cfg pipeConfig
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	chunks   []chunk
+	buffered int
+	written  int64
+	wErr     error
+	rClosed  bool
+	err      error
+}
+
+func newHalfPipe(cfg pipeConfig) *halfPipe {
+	p := &halfPipe{cfg: cfg}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *halfPipe) write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var n int
+	for len(b) > 0 {
+		for p.err == nil && p.wErr == nil && !p.rClosed && p.buffered >= p.cfg.bufSize {
+			p.cond.Wait()
+		}
+		switch {
+		case p.err != nil:
+			return n, p.err
+		case p.wErr != nil, p.rClosed:
+			return n, io.ErrClosedPipe
+		}
+
+		l := p.cfg.bufSize - p.buffered
+		if l > len(b) {
+			l = len(b)
+		}
+		failing := false
+		if p.cfg.failErr != nil && p.written+int64(l) > p.cfg.failAfter {
+			l = int(p.cfg.failAfter - p.written)
+			failing = true
+		}
+
+		if l > 0 {
+			data := make([]byte, l)
+			copy(data, b[:l])
+			p.chunks = append(p.chunks, chunk{data: data, ready: time.Now().Add(p.cfg.latency)})
+			p.buffered += l
+			p.written += int64(l)
+			n += l
+			b = b[l:]
+			p.cond.Broadcast()
+		}
+
+		if failing {
+			return n, p.cfg.failErr
+		}
+	}
+	return n, nil
+}
+
+func (p *halfPipe) read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		for p.err == nil && p.wErr == nil && !p.rClosed && len(p.chunks) == 0 {
+			p.cond.Wait()
+		}
+		switch {
+		case p.err != nil:
+			return 0, p.err
+		case p.rClosed:
+			return 0, io.ErrClosedPipe
+		case len(p.chunks) == 0:
+			return 0, p.wErr
+		}
+
+		wait := time.Until(p.chunks[0].ready)
+		if wait <= 0 {
+			break
+		}
+		p.mu.Unlock()
+		time.Sleep(wait)
+		p.mu.Lock()
+	}
+
+	var n int
+	for n < len(b) && len(p.chunks) > 0 && !p.chunks[0].ready.After(time.Now()) {
+		c := &p.chunks[0]
+		m := copy(b[n:], c.data)
+		c.data = c.data[m:]
+		n += m
+		if len(c.data) == 0 {
+			p.chunks = p.chunks[1:]
+		}
+	}
+	p.buffered -= n
+	p.cond.Broadcast()
+
+	return n, nil
+}
+
+func (p *halfPipe) closeWrite(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.wErr == nil {
+		p.wErr = err
+	}
+	p.cond.Broadcast()
+}
+
+func (p *halfPipe) closeRead() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rClosed = true
+	p.cond.Broadcast()
+}
+
+func (p *halfPipe) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.err = err
+	p.cond.Broadcast()
+}
@@ -0,0 +1,111 @@
+package iotest_test
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hamba/testutils/iotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe(t *testing.T) {
+	a, b := iotest.Pipe()
+
+	go func() {
+		_, _ = a.Write([]byte("ping"))
+		_ = a.Close()
+	}()
+	got, err := io.ReadAll(b)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(got))
+
+	_, err = b.Write([]byte("pong"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+func TestPipe_WithBufferSize(t *testing.T) {
+	a, b := iotest.Pipe(iotest.WithBufferSize(4))
+
+	var written atomic.Int64
+	go func() {
+		for i := 0; i < 10; i++ {
+			n, err := a.Write([]byte{byte(i)})
+			if err != nil {
+				return
+			}
+			written.Add(int64(n))
+		}
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int64(4), written.Load())
+
+	p := make([]byte, 2)
+	n, err := b.Read(p)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int64(6), written.Load())
+}
+
+func TestPipe_WithLatency(t *testing.T) {
+	a, b := iotest.Pipe(iotest.WithLatency(50 * time.Millisecond))
+
+	start := time.Now()
+	_, err := a.Write([]byte("test"))
+	require.NoError(t, err)
+
+	p := make([]byte, 4)
+	n, err := b.Read(p)
+	dur := time.Since(start)
+
+	require.NoError(t, err)
+	assert.Equal(t, "test", string(p[:n]))
+	assert.GreaterOrEqual(t, dur, 50*time.Millisecond)
+}
+
+func TestPipe_WithFailAfter(t *testing.T) {
+	wantErr := errors.New("test")
+	a, b := iotest.Pipe(iotest.WithFailAfter(6, wantErr))
+
+	n, err := a.Write([]byte("0123"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	n, err = a.Write([]byte("4567"))
+	assert.ErrorIs(t, err, wantErr)
+	assert.Equal(t, 2, n)
+
+	p := make([]byte, 10)
+	n, err = b.Read(p)
+	require.NoError(t, err)
+	assert.Equal(t, "012345", string(p[:n]))
+}
+
+func TestPipe_Fail(t *testing.T) {
+	wantErr := errors.New("test")
+	a, b := iotest.Pipe()
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := b.Read(make([]byte, 1))
+		readErr <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	a.Fail(wantErr)
+
+	select {
+	case err := <-readErr:
+		assert.ErrorIs(t, err, wantErr)
+	case <-time.After(time.Second):
+		t.Fatal("Expected read to fail")
+	}
+	_, err := a.Write([]byte("test"))
+	assert.ErrorIs(t, err, wantErr)
+}
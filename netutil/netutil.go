@@ -0,0 +1,82 @@
+/*
+Package netutil provides network helpers that keep test listeners on loopback interfaces.
+
+Listeners are guaranteed to only bind to 127.0.0.1 or ::1, failing the test
+if a public interface is requested:
+
+	func TestFooBar(t *testing.T) {
+		l := netutil.Listen(t, "tcp", ":0") // Binds to 127.0.0.1.
+
+		// Serve on l.
+	}
+*/
+package netutil
+
+import (
+	"net"
+	"strings"
+)
+
+// TestingT represents a partial *testing.T.
+type TestingT interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+	Cleanup(fn func())
+}
+
+// Listen announces on the given loopback address.
+//
+// An address without a host is bound to the loopback interface. Any other
+// host that is not a loopback address fails the test. The listener
+// is closed when the test completes.
+func Listen(t TestingT, network, address string) net.Listener {
+	t.Helper()
+
+	addr, err := LoopbackAddr(network, address)
+	if err != nil {
+		t.Fatalf("Refusing to listen on %s: %v", address, err)
+		return nil
+	}
+
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		t.Fatalf("Unable to listen on %s: %v", addr, err)
+		return nil
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	return l
+}
+
+// LoopbackAddr returns the address with an empty host replaced by the
+// loopback address of the network. An error is returned if the address
+// host is not a loopback address.
+func LoopbackAddr(network, address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+
+	if host == "" {
+		host = "127.0.0.1"
+		if strings.HasSuffix(network, "6") {
+			host = "::1"
+		}
+		return net.JoinHostPort(host, port), nil
+	}
+
+	if !IsLoopback(host) {
+		return "", &net.AddrError{Err: "not a loopback address", Addr: host}
+	}
+	return address, nil
+}
+
+// IsLoopback determines if the host is a loopback host.
+func IsLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
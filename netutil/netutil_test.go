@@ -0,0 +1,119 @@
+package netutil_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/hamba/testutils/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen(t *testing.T) {
+	l := netutil.Listen(t, "tcp", ":0")
+
+	host, _, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", host)
+}
+
+func TestListen_RefusesPublicAddress(t *testing.T) {
+	mockT := new(MockTestingT)
+	mockT.On("Helper")
+	mockT.On("Fatalf", "Refusing to listen on %s: %v", mock.Anything).Once()
+
+	l := netutil.Listen(mockT, "tcp", "0.0.0.0:0")
+
+	mockT.AssertExpectations(t)
+	assert.Nil(t, l)
+}
+
+func TestLoopbackAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		address string
+		want    string
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:    "empty host",
+			network: "tcp",
+			address: ":8080",
+			want:    "127.0.0.1:8080",
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "empty host tcp6",
+			network: "tcp6",
+			address: ":8080",
+			want:    "[::1]:8080",
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "localhost",
+			network: "tcp",
+			address: "localhost:8080",
+			want:    "localhost:8080",
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "loopback ipv6",
+			network: "tcp",
+			address: "[::1]:8080",
+			want:    "[::1]:8080",
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "unspecified",
+			network: "tcp",
+			address: "0.0.0.0:8080",
+			wantErr: assert.Error,
+		},
+		{
+			name:    "public",
+			network: "tcp",
+			address: "192.168.1.1:8080",
+			wantErr: assert.Error,
+		},
+		{
+			name:    "hostname",
+			network: "tcp",
+			address: "example.com:8080",
+			wantErr: assert.Error,
+		},
+		{
+			name:    "invalid",
+			network: "tcp",
+			address: "invalid",
+			wantErr: assert.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := netutil.LoopbackAddr(tt.network, tt.address)
+
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+type MockTestingT struct {
+	mock.Mock
+}
+
+func (m *MockTestingT) Helper() {
+	m.Called()
+}
+
+func (m *MockTestingT) Fatalf(format string, args ...interface{}) {
+	m.Called(format, fmt.Sprint(args...))
+}
+
+func (m *MockTestingT) Cleanup(fn func()) {
+	m.Called(fn)
+}
@@ -0,0 +1,85 @@
+package netutil
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// PortDir is the directory port lock files are kept in.
+//
+// It is shared between processes, allowing test binaries for
+// different packages to coordinate port usage.
+var PortDir = filepath.Join(os.TempDir(), "testutils-ports")
+
+const maxReserveAttempts = 100
+
+// ReservePort returns a free loopback TCP port that is reserved for the
+// duration of the test across all processes using PortDir.
+func ReservePort(t TestingT) int {
+	t.Helper()
+
+	for i := 0; i < maxReserveAttempts; i++ {
+		port, err := freePort()
+		if err != nil {
+			t.Fatalf("Unable to find a free port: %v", err)
+			return 0
+		}
+
+		f, ok, err := lockPort(port)
+		if err != nil {
+			t.Fatalf("Unable to reserve port %d: %v", port, err)
+			return 0
+		}
+		if !ok {
+			continue
+		}
+
+		t.Cleanup(func() { unlockPort(f) })
+		return port
+	}
+
+	t.Fatalf("Unable to reserve a port after %d attempts", maxReserveAttempts)
+	return 0
+}
+
+// LockPort reserves the given fixed port for the duration of the test,
+// waiting up to timeout for another process to release it.
+func LockPort(t TestingT, port int, timeout time.Duration) {
+	t.Helper()
+
+	stop := time.Now().Add(timeout)
+	for {
+		f, ok, err := lockPort(port)
+		if err != nil {
+			t.Fatalf("Unable to reserve port %d: %v", port, err)
+			return
+		}
+		if ok {
+			t.Cleanup(func() { unlockPort(f) })
+			return
+		}
+
+		if time.Now().After(stop) {
+			t.Fatalf("Timed out waiting to reserve port %d", port)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = l.Close() }()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func portFile(port int) string {
+	return filepath.Join(PortDir, strconv.Itoa(port)+".lock")
+}
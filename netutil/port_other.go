@@ -0,0 +1,45 @@
+//go:build !unix
+
+package netutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// lockPort creates the lock file for the port, returning false if the port
+// is locked by another holder. The lock file is kept open by its holder,
+// which prevents it being removed until the holding process exits.
+func lockPort(port int) (*os.File, bool, error) {
+	if err := os.MkdirAll(PortDir, 0o700); err != nil {
+		return nil, false, err
+	}
+
+	path := portFile(port)
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			if _, err = fmt.Fprint(f, os.Getpid()); err != nil {
+				unlockPort(f)
+				return nil, false, err
+			}
+			return f, true, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, false, err
+		}
+
+		// Removing the lock file only succeeds once its holder has exited.
+		if err = os.Remove(path); err != nil {
+			return nil, false, nil //nolint:nilerr // The port is locked.
+		}
+	}
+	return nil, false, nil
+}
+
+// unlockPort releases the lock, then removes the lock file.
+func unlockPort(f *os.File) {
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+}
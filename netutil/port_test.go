@@ -0,0 +1,79 @@
+package netutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hamba/testutils/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReservePort(t *testing.T) {
+	setPortDir(t)
+
+	var port int
+	t.Run("reserve", func(t *testing.T) {
+		port = netutil.ReservePort(t)
+
+		assert.NotZero(t, port)
+		assert.FileExists(t, filepath.Join(netutil.PortDir, strconv.Itoa(port)+".lock"))
+	})
+
+	assert.NoFileExists(t, filepath.Join(netutil.PortDir, strconv.Itoa(port)+".lock"))
+}
+
+func TestLockPort(t *testing.T) {
+	setPortDir(t)
+
+	netutil.LockPort(t, 54321, time.Second)
+
+	mockT := new(MockTestingT)
+	mockT.On("Helper")
+	mockT.On("Fatalf", "Timed out waiting to reserve port %d", mock.Anything).Once()
+
+	netutil.LockPort(mockT, 54321, 50*time.Millisecond)
+
+	mockT.AssertExpectations(t)
+}
+
+func TestLockPort_RemovesStaleLock(t *testing.T) {
+	setPortDir(t)
+
+	// A pid that is very unlikely to be running.
+	err := os.WriteFile(filepath.Join(netutil.PortDir, "54321.lock"), []byte("999999999"), 0o600)
+	require.NoError(t, err)
+
+	netutil.LockPort(t, 54321, time.Second)
+
+	b, err := os.ReadFile(filepath.Join(netutil.PortDir, "54321.lock"))
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), string(b))
+}
+
+func TestLockPort_IgnoresUnlockedFileOfLiveProcess(t *testing.T) {
+	setPortDir(t)
+
+	// The pid of a live process that does not hold the lock, as after pid reuse.
+	err := os.WriteFile(filepath.Join(netutil.PortDir, "54321.lock"), []byte(strconv.Itoa(os.Getppid())), 0o600)
+	require.NoError(t, err)
+
+	netutil.LockPort(t, 54321, time.Second)
+
+	b, err := os.ReadFile(filepath.Join(netutil.PortDir, "54321.lock"))
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), string(b))
+}
+
+func setPortDir(t *testing.T) {
+	t.Helper()
+
+	dir := netutil.PortDir
+	t.Cleanup(func() { netutil.PortDir = dir })
+
+	netutil.PortDir = t.TempDir()
+}
@@ -0,0 +1,79 @@
+//go:build unix
+
+package netutil
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// lockPort locks the lock file for the port, returning false if the port
+// is locked by another holder. The lock is released by the system when
+// the holding process exits, so locks of crashed processes never linger.
+func lockPort(port int) (*os.File, bool, error) {
+	if err := os.MkdirAll(PortDir, 0o700); err != nil {
+		return nil, false, err
+	}
+
+	path := portFile(port)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600) //nolint:gosec // The path is built from the port.
+		if err != nil {
+			return nil, false, err
+		}
+		if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			_ = f.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+
+		// The previous holder removes the file before releasing the lock,
+		// in which case the lock is on a file no longer at the path.
+		if ok, err := isLockFile(f, path); err != nil || !ok {
+			_ = f.Close()
+			if err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+
+		if err = writePid(f); err != nil {
+			unlockPort(f)
+			return nil, false, err
+		}
+		return f, true, nil
+	}
+}
+
+func isLockFile(f *os.File, path string) (bool, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	pi, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(fi, pi), nil
+}
+
+func writePid(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	return err
+}
+
+// unlockPort removes the lock file while it is still locked, then releases the lock.
+func unlockPort(f *os.File) {
+	_ = os.Remove(f.Name())
+	_ = f.Close()
+}
@@ -0,0 +1,31 @@
+package netutil
+
+import (
+	"context"
+	"net"
+)
+
+// SetDefaultResolver points net.DefaultResolver at the DNS server on addr for the
+// duration of the test, allowing code that does not take a resolver to be tested
+// against a local DNS server.
+//
+// As this changes process-wide state, it must not be used in parallel tests.
+func SetDefaultResolver(t TestingT, addr string) {
+	t.Helper()
+
+	if _, err := LoopbackAddr("udp", addr); err != nil {
+		t.Fatalf("Refusing to resolve using %s: %v", addr, err)
+		return
+	}
+
+	orig := net.DefaultResolver
+	t.Cleanup(func() { net.DefaultResolver = orig })
+
+	net.DefaultResolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
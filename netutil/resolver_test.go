@@ -0,0 +1,57 @@
+package netutil_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hamba/testutils/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDefaultResolver(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	queried := make(chan struct{}, 10)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			if _, _, err := conn.ReadFrom(buf); err != nil {
+				return
+			}
+			queried <- struct{}{}
+		}
+	}()
+
+	orig := net.DefaultResolver
+	t.Run("override", func(t *testing.T) {
+		netutil.SetDefaultResolver(t, conn.LocalAddr().String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, _ = net.DefaultResolver.LookupHost(ctx, "service.test")
+
+		select {
+		case <-queried:
+		case <-time.After(time.Second):
+			t.Error("Expected query to be sent to the test server")
+		}
+	})
+
+	assert.Same(t, orig, net.DefaultResolver)
+}
+
+func TestSetDefaultResolver_RefusesPublicAddress(t *testing.T) {
+	mockT := new(MockTestingT)
+	mockT.On("Helper")
+	mockT.On("Fatalf", "Refusing to resolve using %s: %v", mock.Anything).Once()
+
+	netutil.SetDefaultResolver(mockT, "8.8.8.8:53")
+
+	mockT.AssertExpectations(t)
+}
@@ -0,0 +1,246 @@
+/*
+Package promtest provides utilities for testing Prometheus metrics.
+
+Counters can be asserted on relative to a previous scrape, without depending
+on their absolute values:
+
+	func TestHandler(t *testing.T) {
+		before := promtest.Scrape(t, metricsURL)
+
+		// Make two requests.
+
+		after := promtest.Scrape(t, metricsURL)
+		promtest.AssertDelta(t, before, after, "http_requests_total", map[string]string{"code": "200"}, 2)
+	}
+*/
+package promtest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestingT represents a partial *testing.T.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// Sample is a single metric series value.
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Metrics is a set of scraped samples.
+type Metrics []Sample
+
+// Sum returns the sum of all samples with the given name that
+// have the given labels, and if any samples matched.
+func (m Metrics) Sum(name string, labels map[string]string) (float64, bool) {
+	var (
+		sum   float64
+		found bool
+	)
+	for _, s := range m {
+		if s.Name != name || !hasLabels(s.Labels, labels) {
+			continue
+		}
+		sum += s.Value
+		found = true
+	}
+	return sum, found
+}
+
+func hasLabels(have, want map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Scrape fetches and parses the metrics exposed on the url.
+func Scrape(t TestingT, url string) Metrics {
+	t.Helper()
+
+	resp, err := http.Get(url) //nolint:gosec,noctx // The url is given by the test.
+	if err != nil {
+		t.Fatalf("Unable to scrape %s: %v", url, err)
+		return nil
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unable to scrape %s: unexpected status code %d", url, resp.StatusCode)
+		return nil
+	}
+
+	m, err := Parse(resp.Body)
+	if err != nil {
+		t.Fatalf("Unable to parse metrics from %s: %v", url, err)
+		return nil
+	}
+	return m
+}
+
+// Delta returns the change in the sum of the matching series between two scrapes.
+// Series missing from the before scrape are treated as zero.
+func Delta(t TestingT, before, after Metrics, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	a, ok := after.Sum(name, labels)
+	if !ok {
+		t.Errorf("Expected metric %s%s but got none", name, formatLabels(labels))
+		return 0
+	}
+	b, _ := before.Sum(name, labels)
+
+	return a - b
+}
+
+// AssertDelta asserts the change in the sum of the matching series between two scrapes.
+func AssertDelta(t TestingT, before, after Metrics, name string, labels map[string]string, want float64) {
+	t.Helper()
+
+	assert.InDelta(t, want, Delta(t, before, after, name, labels), 1e-9,
+		"Expected metric %s%s to change by %v", name, formatLabels(labels), want)
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+strconv.Quote(v))
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Parse parses metrics in the Prometheus text exposition format.
+func Parse(r io.Reader) (Metrics, error) {
+	var m Metrics
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		s, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		m = append(m, s)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func parseSample(line string) (Sample, error) {
+	s := Sample{Labels: map[string]string{}}
+
+	i := strings.IndexAny(line, "{ \t")
+	if i <= 0 {
+		return s, errors.New("invalid sample")
+	}
+	s.Name, line = line[:i], line[i:]
+
+	if line[0] == '{' {
+		var err error
+		line, err = parseLabels(line[1:], s.Labels)
+		if err != nil {
+			return s, err
+		}
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 || len(fields) > 2 {
+		return s, errors.New("invalid sample value")
+	}
+	v, err := parseValue(fields[0])
+	if err != nil {
+		return s, err
+	}
+	s.Value = v
+
+	return s, nil
+}
+
+// parseLabels parses labels up to and including the closing brace,
+// returning the remainder of the line.
+func parseLabels(line string, labels map[string]string) (string, error) {
+	for {
+		line = strings.TrimLeft(line, " \t,")
+		if line == "" {
+			return "", errors.New("unterminated labels")
+		}
+		if line[0] == '}' {
+			return line[1:], nil
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 || eq+1 >= len(line) || line[eq+1] != '"' {
+			return "", errors.New("invalid label")
+		}
+		name := strings.TrimSpace(line[:eq])
+		line = line[eq+2:]
+
+		var val strings.Builder
+		closed := false
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			if c == '\\' && i+1 < len(line) {
+				i++
+				switch line[i] {
+				case 'n':
+					val.WriteByte('\n')
+				default:
+					val.WriteByte(line[i])
+				}
+				continue
+			}
+			if c == '"' {
+				line = line[i+1:]
+				closed = true
+				break
+			}
+			val.WriteByte(c)
+		}
+		if !closed {
+			return "", errors.New("unterminated label value")
+		}
+		labels[name] = val.String()
+	}
+}
+
+func parseValue(s string) (float64, error) {
+	switch s {
+	case "+Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
@@ -0,0 +1,120 @@
+package promtest_test
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hamba/testutils/promtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	in := `# HELP http_requests_total The total number of requests.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",code="200"} 10
+http_requests_total{method="POST",code="500",path="/a \"b\"\\c"} 2 1395066363000
+up 1
+temperature{} -Inf
+`
+
+	got, err := promtest.Parse(strings.NewReader(in))
+
+	require.NoError(t, err)
+	require.Len(t, got, 4)
+	assert.Equal(t, promtest.Sample{
+		Name:   "http_requests_total",
+		Labels: map[string]string{"method": "GET", "code": "200"},
+		Value:  10,
+	}, got[0])
+	assert.Equal(t, `/a "b"\c`, got[1].Labels["path"])
+	assert.Equal(t, promtest.Sample{Name: "up", Labels: map[string]string{}, Value: 1}, got[2])
+	assert.True(t, math.IsInf(got[3].Value, -1))
+}
+
+func TestParse_HandlesInvalid(t *testing.T) {
+	tests := []string{
+		`metric{code="200" 1`,
+		`metric{code=200} 1`,
+		`metric{code="200} 1`,
+		`metric abc`,
+		`metric`,
+	}
+
+	for _, in := range tests {
+		t.Run(in, func(t *testing.T) {
+			_, err := promtest.Parse(strings.NewReader(in))
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestScrape(t *testing.T) {
+	count := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		_, _ = w.Write([]byte(`http_requests_total{code="200"} ` + strings.Repeat("1", count) + "\n"))
+	}))
+	t.Cleanup(srv.Close)
+
+	before := promtest.Scrape(t, srv.URL)
+	after := promtest.Scrape(t, srv.URL)
+
+	assert.Equal(t, float64(10), promtest.Delta(t, before, after, "http_requests_total", map[string]string{"code": "200"}))
+	promtest.AssertDelta(t, before, after, "http_requests_total", nil, 10)
+}
+
+func TestDelta_MissingBefore(t *testing.T) {
+	after := promtest.Metrics{
+		{Name: "requests", Labels: map[string]string{"code": "200"}, Value: 2},
+		{Name: "requests", Labels: map[string]string{"code": "500"}, Value: 1},
+	}
+
+	got := promtest.Delta(t, nil, after, "requests", nil)
+
+	assert.Equal(t, float64(3), got)
+}
+
+func TestAssertDelta_Fails(t *testing.T) {
+	before := promtest.Metrics{{Name: "requests", Labels: map[string]string{"code": "200"}, Value: 2}}
+	after := promtest.Metrics{{Name: "requests", Labels: map[string]string{"code": "200"}, Value: 5}}
+
+	mockT := new(MockTestingT)
+	mockT.On("Helper")
+	mockT.On("Errorf", "\n%s", mock.Anything).Twice()
+	mockT.On("Errorf", "Expected metric %s%s but got none", []interface{}{"missing", ""}).Once()
+
+	promtest.AssertDelta(mockT, before, after, "requests", map[string]string{"code": "200"}, 2)
+	promtest.AssertDelta(mockT, before, after, "missing", nil, 2)
+
+	mockT.AssertExpectations(t)
+	var msgs []string
+	for _, call := range mockT.Calls {
+		if call.Method == "Errorf" && call.Arguments.String(0) == "\n%s" {
+			msgs = append(msgs, call.Arguments.Get(1).([]interface{})[0].(string))
+		}
+	}
+	require.Len(t, msgs, 2)
+	assert.Contains(t, msgs[0], `Expected metric requests{code="200"} to change by 2`)
+}
+
+type MockTestingT struct {
+	mock.Mock
+}
+
+func (m *MockTestingT) Helper() {
+	m.Called()
+}
+
+func (m *MockTestingT) Errorf(format string, args ...interface{}) {
+	m.Called(format, args)
+}
+
+func (m *MockTestingT) Fatalf(format string, args ...interface{}) {
+	m.Called(format, args)
+}
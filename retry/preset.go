@@ -0,0 +1,120 @@
+package retry
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hamba/testutils/clock"
+)
+
+// PresetEnv is the environment variable used to select the preset returned by FromEnv.
+const PresetEnv = "TESTUTILS_RETRY_PRESET"
+
+// minExponentialSleep is the smallest sleep between exponential attempts.
+const minExponentialSleep = time.Millisecond
+
+// Exponential is a time based retry policy with exponential backoff.
+type Exponential struct {
+	timeout  time.Duration
+	minSleep time.Duration
+	maxSleep time.Duration
+	clock    clock.Clock
+
+	stop  time.Time
+	sleep time.Duration
+}
+
+// NewExponential returns a time based retry policy that doubles the sleep
+// between attempts, starting at minSleep and capped at maxSleep.
+// A minSleep below a millisecond is raised to a millisecond, and a maxSleep
+// below minSleep is raised to minSleep.
+func NewExponential(timeout, minSleep, maxSleep time.Duration) *Exponential {
+	if minSleep < minExponentialSleep {
+		minSleep = minExponentialSleep
+	}
+	if maxSleep < minSleep {
+		maxSleep = minSleep
+	}
+
+	return &Exponential{
+		timeout:  timeout,
+		minSleep: minSleep,
+		maxSleep: maxSleep,
+	}
+}
+
+// WithClock sets the clock used to track the timeout and sleep between attempts.
+func (e *Exponential) WithClock(clk clock.Clock) *Exponential {
+	e.clock = clk
+
+	return e
+}
+
+// Next determines if the function can be retried.
+func (e *Exponential) Next() bool {
+	clk := clockOrReal(e.clock)
+
+	if e.stop.IsZero() {
+		e.stop = clk.Now().Add(e.timeout)
+		e.sleep = e.minSleep
+		return true
+	}
+
+	if clk.Now().After(e.stop) {
+		return false
+	}
+
+	clk.Sleep(e.sleep)
+
+	e.sleep *= 2
+	if e.sleep > e.maxSleep {
+		e.sleep = e.maxSleep
+	}
+	return true
+}
+
+// Fast returns a policy for quick local iteration, giving up after a second.
+func Fast() *Exponential {
+	return NewExponential(time.Second, 5*time.Millisecond, 100*time.Millisecond)
+}
+
+// CI returns a policy tolerant of slow and contended CI agents, giving up after 30 seconds.
+func CI() *Exponential {
+	return NewExponential(30*time.Second, 50*time.Millisecond, 2*time.Second)
+}
+
+// Soak returns a policy for long-running soak tests, giving up after 5 minutes.
+func Soak() *Exponential {
+	return NewExponential(5*time.Minute, 100*time.Millisecond, 10*time.Second)
+}
+
+// FromEnv returns the preset named in the PresetEnv environment variable,
+// one of "fast", "ci" or "soak". When unset, CI is returned if the CI
+// environment variable is set, otherwise Fast is returned. An unknown
+// preset fails the test.
+func FromEnv(t TestingT) *Exponential {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	switch preset := os.Getenv(PresetEnv); strings.ToLower(preset) {
+	case "fast":
+		return Fast()
+	case "ci":
+		return CI()
+	case "soak":
+		return Soak()
+	case "":
+	default:
+		t.Log(fmt.Sprintf("Unknown retry preset %q in %s, expected one of fast, ci or soak", preset, PresetEnv))
+		t.FailNow()
+		return Fast()
+	}
+
+	if os.Getenv("CI") != "" {
+		return CI()
+	}
+	return Fast()
+}
@@ -0,0 +1,104 @@
+package retry_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hamba/testutils/clock"
+	"github.com/hamba/testutils/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExponential_Next(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clk := clock.NewFake(now)
+	p := retry.NewExponential(time.Minute, time.Second, 10*time.Second).WithClock(clk)
+
+	var sleeps []time.Duration
+	last := clk.Now()
+	for p.Next() {
+		sleeps = append(sleeps, clk.Now().Sub(last))
+		last = clk.Now()
+	}
+
+	want := []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second, 10 * time.Second, 10 * time.Second, 10 * time.Second}
+	assert.Equal(t, want, sleeps)
+}
+
+func TestExponential_NextHandlesZeroSleep(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clk := clock.NewFake(now)
+	p := retry.NewExponential(10*time.Millisecond, 0, 0).WithClock(clk)
+
+	var sleeps []time.Duration
+	last := clk.Now()
+	for p.Next() {
+		sleeps = append(sleeps, clk.Now().Sub(last))
+		last = clk.Now()
+	}
+
+	require.Len(t, sleeps, 12)
+	for _, sleep := range sleeps[1:] {
+		assert.Equal(t, time.Millisecond, sleep)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name   string
+		preset string
+		ci     string
+		want   *retry.Exponential
+	}{
+		{
+			name:   "fast",
+			preset: "fast",
+			want:   retry.Fast(),
+		},
+		{
+			name:   "ci",
+			preset: "CI",
+			want:   retry.CI(),
+		},
+		{
+			name:   "soak",
+			preset: "soak",
+			want:   retry.Soak(),
+		},
+		{
+			name: "ci environment",
+			ci:   "true",
+			want: retry.CI(),
+		},
+		{
+			name: "default",
+			want: retry.Fast(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(retry.PresetEnv, tt.preset)
+			t.Setenv("CI", tt.ci)
+
+			got := retry.FromEnv(t)
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFromEnv_HandlesUnknownPreset(t *testing.T) {
+	t.Setenv(retry.PresetEnv, "slow")
+
+	mockT := new(MockTestingT)
+	mockT.On("Log", mock.Anything).Once()
+	mockT.On("FailNow").Once()
+
+	got := retry.FromEnv(mockT)
+
+	mockT.AssertExpectations(t)
+	assert.Equal(t, retry.Fast(), got)
+}
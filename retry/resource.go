@@ -0,0 +1,28 @@
+package retry
+
+import (
+	"os"
+
+	"github.com/hamba/testutils/netutil"
+)
+
+// WithFreshPort returns a free loopback TCP port reserved for the current attempt.
+// A new port is reserved on every attempt, and released when the attempt completes,
+// so a retry is not made against a port leaked by a previous attempt.
+func WithFreshPort(t *SubT) int {
+	return netutil.ReservePort(t)
+}
+
+// WithFreshTempDir returns a new temporary directory for the current attempt.
+// A new directory is created on every attempt, and removed when the attempt
+// completes, so a retry does not see the files of a previous attempt.
+func WithFreshTempDir(t *SubT) string {
+	dir, err := os.MkdirTemp("", "retry")
+	if err != nil {
+		t.Fatalf("Unable to create temporary directory: %v", err)
+		return ""
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	return dir
+}
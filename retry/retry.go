@@ -14,11 +14,16 @@ A simple usage is as simple as
 package retry
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"os/exec"
 	"runtime"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/hamba/testutils/clock"
 )
 
 // DefaultPolicy is a function that returns the default retry policy used with Run.
@@ -85,6 +90,10 @@ func (t *SubT) Cleanup(fn func()) {
 	t.cleanups = append(t.cleanups, fn)
 }
 
+// Helper marks the calling function as a test helper function.
+// It is a no-op, allowing test helpers to be used within a test run.
+func (t *SubT) Helper() {}
+
 // Log adds a log line to the current test run.
 func (t *SubT) Log(args ...interface{}) {
 	t.log(fmt.Sprintln(args...))
@@ -172,6 +181,69 @@ func RunWith(t TestingT, p Policy, fn func(t *SubT)) {
 	}
 }
 
+// Command retries the command created by newCmd with policy p until it exits
+// successfully, returning the combined output of the last attempt.
+//
+// A new command is created for each attempt. The combined output of each
+// attempt is logged, and also written to any stdout and stderr set on the command.
+func Command(t TestingT, p Policy, newCmd func() *exec.Cmd) []byte {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	var (
+		attempt int
+		out     []byte
+	)
+	RunWith(t, p, func(st *SubT) {
+		attempt++
+
+		cmd := newCmd()
+		if cmd.Err != nil {
+			st.Fatalf("Command %q could not be found: %v", cmd.Path, cmd.Err)
+		}
+
+		buf := &syncBuffer{}
+		cmd.Stdout = teeWriter(cmd.Stdout, buf)
+		cmd.Stderr = teeWriter(cmd.Stderr, buf)
+		err := cmd.Run()
+		out = buf.Bytes()
+		if err != nil {
+			t.Log(fmt.Sprintf("Command %q attempt %d failed: %v\n%s", cmd.String(), attempt, err, out))
+			st.FailNow()
+		}
+		t.Log(fmt.Sprintf("Command %q attempt %d succeeded\n%s", cmd.String(), attempt, out))
+	})
+	return out
+}
+
+func teeWriter(w io.Writer, buf *syncBuffer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(w, buf)
+}
+
+// syncBuffer is a buffer safe for concurrent writes from stdout and stderr.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
 // Policy represents a retry strategy.
 type Policy interface {
 	// Next determines if the function can be retried. Next is
@@ -184,6 +256,7 @@ type Policy interface {
 type Counter struct {
 	attempts int
 	sleep    time.Duration
+	clock    clock.Clock
 
 	count int
 }
@@ -196,6 +269,13 @@ func NewCounter(attempts int, sleep time.Duration) *Counter {
 	}
 }
 
+// WithClock sets the clock used to sleep between attempts.
+func (c *Counter) WithClock(clk clock.Clock) *Counter {
+	c.clock = clk
+
+	return c
+}
+
 // Next determines if the function can be retried.
 func (c *Counter) Next() bool {
 	if c.count >= c.attempts {
@@ -203,7 +283,7 @@ func (c *Counter) Next() bool {
 	}
 
 	if c.count > 0 {
-		time.Sleep(c.sleep)
+		clockOrReal(c.clock).Sleep(c.sleep)
 	}
 
 	c.count++
@@ -214,6 +294,7 @@ func (c *Counter) Next() bool {
 type Timer struct {
 	timeout time.Duration
 	sleep   time.Duration
+	clock   clock.Clock
 
 	stop time.Time
 }
@@ -226,17 +307,33 @@ func NewTimer(timeout, sleep time.Duration) *Timer {
 	}
 }
 
+// WithClock sets the clock used to track the timeout and sleep between attempts.
+func (t *Timer) WithClock(clk clock.Clock) *Timer {
+	t.clock = clk
+
+	return t
+}
+
 // Next determines if the function can be retried.
 func (t *Timer) Next() bool {
+	clk := clockOrReal(t.clock)
+
 	if t.stop.IsZero() {
-		t.stop = time.Now().Add(t.timeout)
+		t.stop = clk.Now().Add(t.timeout)
 		return true
 	}
 
-	if time.Now().After(t.stop) {
+	if clk.Now().After(t.stop) {
 		return false
 	}
 
-	time.Sleep(t.sleep)
+	clk.Sleep(t.sleep)
 	return true
 }
+
+func clockOrReal(clk clock.Clock) clock.Clock {
+	if clk == nil {
+		return clock.Real{}
+	}
+	return clk
+}
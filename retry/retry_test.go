@@ -1,13 +1,21 @@
 package retry_test
 
 import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/hamba/testutils/clock"
 	"github.com/hamba/testutils/retry"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 const timeDeltaAllowed = float64(25 * time.Millisecond)
@@ -102,6 +110,142 @@ func TestRunWith_RunsCleanup(t *testing.T) {
 	assert.Equal(t, 3, runs)
 }
 
+func TestWithFreshPort(t *testing.T) {
+	mockT := new(MockTestingT)
+	mockT.On("FailNow").Once()
+
+	var ports []int
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		retry.RunWith(mockT, retry.NewCounter(3, 10*time.Millisecond), func(t *retry.SubT) {
+			ports = append(ports, retry.WithFreshPort(t))
+			t.FailNow()
+		})
+	}()
+	wg.Wait()
+
+	mockT.AssertExpectations(t)
+	require.Len(t, ports, 3)
+	for _, port := range ports {
+		assert.NotZero(t, port)
+	}
+}
+
+func TestWithFreshTempDir(t *testing.T) {
+	mockT := new(MockTestingT)
+	mockT.On("FailNow").Once()
+
+	var dirs []string
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		retry.RunWith(mockT, retry.NewCounter(3, 10*time.Millisecond), func(t *retry.SubT) {
+			dir := retry.WithFreshTempDir(t)
+			dirs = append(dirs, dir)
+
+			if _, err := os.Stat(filepath.Join(dir, "leaked")); err == nil {
+				t.Fatal("Expected a fresh directory")
+			}
+			if err := os.WriteFile(filepath.Join(dir, "leaked"), []byte("test"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.FailNow()
+		})
+	}()
+	wg.Wait()
+
+	mockT.AssertExpectations(t)
+	require.Len(t, dirs, 3)
+	assert.NotEqual(t, dirs[0], dirs[1])
+	for _, dir := range dirs {
+		assert.NoDirExists(t, dir)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	mockT := new(MockTestingT)
+	mockT.On("Log", mock.Anything).Once()
+
+	var out []byte
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		out = retry.Command(mockT, retry.NewCounter(3, 10*time.Millisecond), func() *exec.Cmd {
+			return exec.Command("sh", "-c", "echo test output; echo test error >&2")
+		})
+	}()
+	wg.Wait()
+
+	mockT.AssertExpectations(t)
+	assert.Contains(t, string(out), "test output\n")
+	assert.Contains(t, string(out), "test error\n")
+	args := mockT.Calls[0].Arguments.Get(0).([]interface{})
+	assert.Contains(t, args[0], "attempt 1 succeeded")
+}
+
+func TestCommand_WritesOutput(t *testing.T) {
+	mockT := new(MockTestingT)
+	mockT.On("Log", mock.Anything).Once()
+
+	var stdout, stderr bytes.Buffer
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		retry.Command(mockT, retry.NewCounter(3, 10*time.Millisecond), func() *exec.Cmd {
+			cmd := exec.Command("sh", "-c", "cat; echo test error >&2")
+			cmd.Stdin = strings.NewReader("test input")
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			return cmd
+		})
+	}()
+	wg.Wait()
+
+	mockT.AssertExpectations(t)
+	assert.Equal(t, "test input", stdout.String())
+	assert.Equal(t, "test error\n", stderr.String())
+}
+
+func TestCommand_HandlesFailing(t *testing.T) {
+	dir := t.TempDir()
+
+	mockT := new(MockTestingT)
+	mockT.On("Log", mock.Anything).Times(3)
+	mockT.On("FailNow").Once()
+
+	var out []byte
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		out = retry.Command(mockT, retry.NewCounter(3, 10*time.Millisecond), func() *exec.Cmd {
+			cmd := exec.Command("sh", "-c", "echo attempt >> runs; echo test output; exit 1")
+			cmd.Dir = dir
+			return cmd
+		})
+	}()
+	wg.Wait()
+
+	mockT.AssertExpectations(t)
+	assert.Equal(t, "test output\n", string(out))
+	for i, call := range mockT.Calls[:3] {
+		args := call.Arguments.Get(0).([]interface{})
+		assert.Contains(t, args[0], fmt.Sprintf("attempt %d failed", i+1))
+		assert.Contains(t, args[0], "test output")
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "runs"))
+	require.NoError(t, err)
+	assert.Equal(t, "attempt\nattempt\nattempt\n", string(b))
+}
+
 func TestCounter_Next(t *testing.T) {
 	p := retry.NewCounter(3, 100*time.Millisecond)
 
@@ -132,6 +276,42 @@ func TestTimer_Next(t *testing.T) {
 	assert.InDelta(t, 200*time.Millisecond, dur, timeDeltaAllowed)
 }
 
+func TestCounter_NextWithClock(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clk := clock.NewFake(now)
+	p := retry.NewCounter(3, time.Minute).WithClock(clk)
+
+	runs := 0
+
+	start := time.Now()
+	for p.Next() {
+		runs++
+	}
+	dur := time.Since(start)
+
+	assert.Equal(t, 3, runs)
+	assert.Equal(t, now.Add(2*time.Minute), clk.Now())
+	assert.InDelta(t, 0, dur, timeDeltaAllowed)
+}
+
+func TestTimer_NextWithClock(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clk := clock.NewFake(now)
+	p := retry.NewTimer(time.Hour, 30*time.Minute).WithClock(clk)
+
+	runs := 0
+
+	start := time.Now()
+	for p.Next() {
+		runs++
+	}
+	dur := time.Since(start)
+
+	assert.Equal(t, 4, runs)
+	assert.Equal(t, now.Add(90*time.Minute), clk.Now())
+	assert.InDelta(t, 0, dur, timeDeltaAllowed)
+}
+
 type MockTestingT struct {
 	mock.Mock
 }
@@ -0,0 +1,290 @@
+package sqltest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+)
+
+type conn struct {
+	driver.Conn
+
+	rec *Recorder
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		s   driver.Stmt
+		err error
+	)
+	if prep, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		s, err = prep.PrepareContext(ctx, query)
+	} else {
+		s, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &stmt{Stmt: s, query: query, rec: c.rec}, nil
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin() //nolint:staticcheck // Required for drivers without BeginTx.
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	res, err := e.ExecContext(ctx, query, args)
+	if !errors.Is(err, driver.ErrSkip) {
+		c.rec.record(query, args)
+	}
+	return res, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	rows, err := q.QueryContext(ctx, query, args)
+	if !errors.Is(err, driver.ErrSkip) {
+		c.rec.record(query, args)
+	}
+	return rows, err
+}
+
+func (c *conn) CheckNamedValue(v *driver.NamedValue) error {
+	if chk, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return chk.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+type stmt struct {
+	driver.Stmt
+
+	query string
+	rec   *Recorder
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.rec.record(s.query, namedValues(args))
+
+	return s.Stmt.Exec(args) //nolint:staticcheck // Required for drivers without ExecContext.
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.rec.record(s.query, namedValues(args))
+
+	return s.Stmt.Query(args) //nolint:staticcheck // Required for drivers without QueryContext.
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := s.Stmt.(driver.StmtExecContext)
+	if !ok {
+		vals, err := values(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Exec(vals)
+	}
+
+	s.rec.record(s.query, args)
+	return e.ExecContext(ctx, args)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := s.Stmt.(driver.StmtQueryContext)
+	if !ok {
+		vals, err := values(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Query(vals)
+	}
+
+	s.rec.record(s.query, args)
+	return q.QueryContext(ctx, args)
+}
+
+func (s *stmt) CheckNamedValue(v *driver.NamedValue) error {
+	if chk, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return chk.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func (s *stmt) ColumnConverter(idx int) driver.ValueConverter {
+	if cc, ok := s.Stmt.(driver.ColumnConverter); ok { //nolint:staticcheck // Required for drivers without NamedValueChecker.
+		return cc.ColumnConverter(idx)
+	}
+	return driver.DefaultParameterConverter
+}
+
+// dbConn is a driver connection executing statements on a connection
+// of an existing database.
+type dbConn struct {
+	*sql.Conn
+}
+
+func (c *dbConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *dbConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	s, err := c.Conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &dbStmt{Stmt: s}, nil
+}
+
+func (c *dbConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *dbConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.IsolationLevel(opts.Isolation), ReadOnly: opts.ReadOnly})
+}
+
+func (c *dbConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.ExecContext(ctx, query, dbArgs(args)...)
+}
+
+func (c *dbConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.Conn.QueryContext(ctx, query, dbArgs(args)...) //nolint:sqlclosecheck // Closed by database/sql.
+	if err != nil {
+		return nil, err
+	}
+	return &dbRows{Rows: rows}, nil
+}
+
+func (c *dbConn) Ping(ctx context.Context) error {
+	return c.PingContext(ctx)
+}
+
+type dbStmt struct {
+	*sql.Stmt
+}
+
+func (s *dbStmt) NumInput() int {
+	return -1
+}
+
+func (s *dbStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *dbStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *dbStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.Stmt.ExecContext(ctx, dbArgs(args)...)
+}
+
+func (s *dbStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := s.Stmt.QueryContext(ctx, dbArgs(args)...) //nolint:sqlclosecheck // Closed by database/sql.
+	if err != nil {
+		return nil, err
+	}
+	return &dbRows{Rows: rows}, nil
+}
+
+type dbRows struct {
+	*sql.Rows
+}
+
+func (r *dbRows) Columns() []string {
+	cols, _ := r.Rows.Columns()
+	return cols
+}
+
+func (r *dbRows) Next(dest []driver.Value) error {
+	if !r.Rows.Next() {
+		if err := r.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+
+	vals := make([]interface{}, len(dest))
+	ptrs := make([]interface{}, len(dest))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err := r.Scan(ptrs...); err != nil {
+		return err
+	}
+	for i, v := range vals {
+		dest[i] = v
+	}
+	return nil
+}
+
+func dbArgs(args []driver.NamedValue) []interface{} {
+	vals := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			vals[i] = sql.Named(arg.Name, arg.Value)
+			continue
+		}
+		vals[i] = arg.Value
+	}
+	return vals
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+func values(args []driver.NamedValue) ([]driver.Value, error) {
+	vals := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("sqltest: driver does not support named parameters")
+		}
+		vals[i] = arg.Value
+	}
+	return vals, nil
+}
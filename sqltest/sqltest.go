@@ -0,0 +1,197 @@
+/*
+Package sqltest provides utilities for testing database code.
+
+Statements executed against a database can be recorded and asserted on:
+
+	func TestStore(t *testing.T) {
+		db, rec := sqltest.Open(t, pq.Driver{}, dsn)
+
+		store := NewStore(db)
+		_, _ = store.Users(ctx)
+
+		rec.AssertQueriedTimes(t, `^SELECT .* FROM users`, 1)
+	}
+
+An existing database can be recorded with Wrap.
+*/
+package sqltest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"sync"
+)
+
+// TestingT represents a partial *testing.T.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Cleanup(fn func())
+}
+
+// Query is a recorded statement.
+type Query struct {
+	SQL  string
+	Args []interface{}
+}
+
+// Recorder records statements executed on a database.
+type Recorder struct {
+	mu      sync.Mutex
+	queries []Query
+}
+
+// Open opens a database using the driver and dsn, recording all executed statements.
+//
+// The database is closed when the test completes.
+func Open(t TestingT, drv driver.Driver, dsn string) (*sql.DB, *Recorder) {
+	t.Helper()
+
+	rec := &Recorder{}
+	db := sql.OpenDB(&connector{drv: drv, dsn: dsn, rec: rec})
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db, rec
+}
+
+// Wrap returns a database executing all statements on the existing database,
+// recording them. The existing database is left open.
+//
+// The returned database is closed when the test completes.
+func Wrap(t TestingT, db *sql.DB) (*sql.DB, *Recorder) {
+	t.Helper()
+
+	rec := &Recorder{}
+	wrapped := sql.OpenDB(&dbConnector{db: db, rec: rec})
+	t.Cleanup(func() { _ = wrapped.Close() })
+
+	return wrapped, rec
+}
+
+func (r *Recorder) record(query string, args []driver.NamedValue) {
+	q := Query{SQL: query}
+	for _, arg := range args {
+		q.Args = append(q.Args, arg.Value)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.queries = append(r.queries, q)
+}
+
+// Queries returns the recorded statements.
+func (r *Recorder) Queries() []Query {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Query(nil), r.queries...)
+}
+
+// Reset clears the recorded statements.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.queries = nil
+}
+
+// AssertQueried asserts a statement matching the regular expression was executed.
+func (r *Recorder) AssertQueried(t TestingT, pattern string) {
+	t.Helper()
+
+	if n, ok := r.count(t, pattern); ok && n == 0 {
+		t.Errorf("Expected a statement matching %q but got none", pattern)
+	}
+}
+
+// AssertNotQueried asserts no statement matching the regular expression was executed.
+func (r *Recorder) AssertNotQueried(t TestingT, pattern string) {
+	t.Helper()
+
+	if n, ok := r.count(t, pattern); ok && n > 0 {
+		t.Errorf("Expected no statement matching %q but got %d", pattern, n)
+	}
+}
+
+// AssertQueriedTimes asserts a statement matching the regular expression
+// was executed exactly n times.
+func (r *Recorder) AssertQueriedTimes(t TestingT, pattern string, n int) {
+	t.Helper()
+
+	if got, ok := r.count(t, pattern); ok && got != n {
+		t.Errorf("Expected a statement matching %q %d times but got %d times", pattern, n, got)
+	}
+}
+
+// count returns the number of statements matching the regular expression,
+// reporting an invalid expression on t.
+func (r *Recorder) count(t TestingT, pattern string) (int, bool) {
+	t.Helper()
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		t.Errorf("Invalid pattern %q: %v", pattern, err)
+		return 0, false
+	}
+
+	var n int
+	for _, q := range r.Queries() {
+		if re.MatchString(q.SQL) {
+			n++
+		}
+	}
+	return n, true
+}
+
+type connector struct {
+	drv driver.Driver
+	dsn string
+	rec *Recorder
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	var (
+		dc  driver.Conn
+		err error
+	)
+	if drvCtx, ok := c.drv.(driver.DriverContext); ok {
+		var conn driver.Connector
+		conn, err = drvCtx.OpenConnector(c.dsn)
+		if err != nil {
+			return nil, err
+		}
+		dc, err = conn.Connect(ctx)
+	} else {
+		dc, err = c.drv.Open(c.dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &conn{Conn: dc, rec: c.rec}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.drv
+}
+
+type dbConnector struct {
+	db  *sql.DB
+	rec *Recorder
+}
+
+func (c *dbConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	dc, err := c.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conn{Conn: &dbConn{Conn: dc}, rec: c.rec}, nil
+}
+
+func (c *dbConnector) Driver() driver.Driver {
+	return c.db.Driver()
+}
@@ -0,0 +1,206 @@
+package sqltest_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/hamba/testutils/sqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpen_RecordsQueries(t *testing.T) {
+	tests := []struct {
+		name string
+		drv  driver.Driver
+	}{
+		{
+			name: "execer",
+			drv:  fakeDriver{execer: true},
+		},
+		{
+			name: "prepared",
+			drv:  fakeDriver{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := sqltest.Open(t, tt.drv, "dsn")
+
+			_, err := db.Exec("INSERT INTO users (name) VALUES (?)", "bob")
+			require.NoError(t, err)
+			rows, err := db.Query("SELECT id FROM users WHERE name = ?", "bob")
+			require.NoError(t, err)
+			_ = rows.Close()
+
+			want := []sqltest.Query{
+				{SQL: "INSERT INTO users (name) VALUES (?)", Args: []interface{}{"bob"}},
+				{SQL: "SELECT id FROM users WHERE name = ?", Args: []interface{}{"bob"}},
+			}
+			assert.Equal(t, want, rec.Queries())
+		})
+	}
+}
+
+func TestOpen_ForwardsPing(t *testing.T) {
+	db, _ := sqltest.Open(t, fakeDriver{pingErr: errors.New("test error")}, "dsn")
+
+	err := db.Ping()
+
+	assert.EqualError(t, err, "test error")
+}
+
+func TestWrap_RecordsQueries(t *testing.T) {
+	inner, innerRec := sqltest.Open(t, fakeDriver{execer: true}, "dsn")
+	db, rec := sqltest.Wrap(t, inner)
+
+	_, err := db.Exec("INSERT INTO users (name) VALUES (?)", "bob")
+	require.NoError(t, err)
+	var id int64
+	err = db.QueryRow("SELECT id FROM users WHERE name = ?", "bob").Scan(&id)
+	require.NoError(t, err)
+	stmt, err := db.Prepare("DELETE FROM users WHERE id = ?")
+	require.NoError(t, err)
+	_, err = stmt.Exec(id)
+	require.NoError(t, err)
+	_ = stmt.Close()
+
+	want := []sqltest.Query{
+		{SQL: "INSERT INTO users (name) VALUES (?)", Args: []interface{}{"bob"}},
+		{SQL: "SELECT id FROM users WHERE name = ?", Args: []interface{}{"bob"}},
+		{SQL: "DELETE FROM users WHERE id = ?", Args: []interface{}{int64(1)}},
+	}
+	assert.Equal(t, int64(1), id)
+	assert.Equal(t, want, rec.Queries())
+	assert.Equal(t, want, innerRec.Queries())
+}
+
+func TestRecorder_Assertions(t *testing.T) {
+	db, rec := sqltest.Open(t, fakeDriver{execer: true}, "dsn")
+
+	for i := 0; i < 3; i++ {
+		rows, err := db.Query("SELECT * FROM orders WHERE user_id = ?", i)
+		require.NoError(t, err)
+		_ = rows.Close()
+	}
+
+	rec.AssertQueried(t, `FROM orders`)
+	rec.AssertQueriedTimes(t, `^SELECT .* FROM orders`, 3)
+	rec.AssertNotQueried(t, `FROM users`)
+
+	rec.Reset()
+	assert.Empty(t, rec.Queries())
+}
+
+func TestRecorder_AssertionsFail(t *testing.T) {
+	db, rec := sqltest.Open(t, fakeDriver{execer: true}, "dsn")
+
+	_, err := db.Exec("DELETE FROM orders")
+	require.NoError(t, err)
+
+	mockT := new(MockTestingT)
+	mockT.On("Helper")
+	mockT.On("Errorf", "Expected a statement matching %q but got none", mock.Anything).Once()
+	mockT.On("Errorf", "Expected no statement matching %q but got %d", mock.Anything).Once()
+	mockT.On("Errorf", "Expected a statement matching %q %d times but got %d times", mock.Anything).Once()
+
+	rec.AssertQueried(mockT, `FROM users`)
+	rec.AssertNotQueried(mockT, `FROM orders`)
+	rec.AssertQueriedTimes(mockT, `FROM orders`, 2)
+
+	mockT.AssertExpectations(t)
+}
+
+func TestRecorder_AssertionsHandleInvalidPattern(t *testing.T) {
+	_, rec := sqltest.Open(t, fakeDriver{execer: true}, "dsn")
+
+	mockT := new(MockTestingT)
+	mockT.On("Helper")
+	mockT.On("Errorf", "Invalid pattern %q: %v", mock.Anything).Times(3)
+
+	rec.AssertQueried(mockT, `(`)
+	rec.AssertNotQueried(mockT, `(`)
+	rec.AssertQueriedTimes(mockT, `(`, 1)
+
+	mockT.AssertExpectations(t)
+	mockT.AssertNumberOfCalls(t, "Errorf", 3)
+}
+
+type MockTestingT struct {
+	mock.Mock
+}
+
+func (m *MockTestingT) Helper() {
+	m.Called()
+}
+
+func (m *MockTestingT) Errorf(format string, args ...interface{}) {
+	m.Called(format, args)
+}
+
+func (m *MockTestingT) Cleanup(fn func()) {
+	m.Called(fn)
+}
+
+type fakeDriver struct {
+	execer  bool
+	pingErr error
+}
+
+func (d fakeDriver) Open(string) (driver.Conn, error) {
+	if d.execer {
+		return &fakeExecerConn{fakeConn: fakeConn{pingErr: d.pingErr}}, nil
+	}
+	return &fakeConn{pingErr: d.pingErr}, nil
+}
+
+type fakeConn struct {
+	pingErr error
+}
+
+func (c *fakeConn) Ping(context.Context) error { return c.pingErr }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return nil, fmt.Errorf("not supported") }
+
+type fakeExecerConn struct {
+	fakeConn
+}
+
+func (c *fakeExecerConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeExecerConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{}, nil
+}
+
+type fakeStmt struct{}
+
+func (s *fakeStmt) Close() error                               { return nil }
+func (s *fakeStmt) NumInput() int                              { return -1 }
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error)  { return &fakeRows{}, nil }
+
+type fakeRows struct {
+	done bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
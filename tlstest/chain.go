@@ -0,0 +1,53 @@
+package tlstest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// Chain is a root, intermediate and leaf certificate chain.
+type Chain struct {
+	Root         *Certificate
+	Intermediate *Certificate
+	Leaf         *Certificate
+}
+
+// NewChain generates a certificate chain with a leaf valid for the given hosts.
+func NewChain(t TestingT, hosts ...string) *Chain {
+	t.Helper()
+
+	root := NewCA(t, "Test Root CA")
+	inter := root.NewIntermediate(t, "Test Intermediate CA")
+	leaf := inter.NewLeaf(t, "Test Leaf", WithHosts(hosts...))
+
+	return &Chain{
+		Root:         root,
+		Intermediate: inter,
+		Leaf:         leaf,
+	}
+}
+
+// RootPool returns a certificate pool containing the root certificate.
+func (c *Chain) RootPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.Root.Cert)
+	return pool
+}
+
+// Certificate returns a correctly configured TLS certificate
+// presenting the leaf followed by the intermediate.
+func (c *Chain) Certificate() tls.Certificate {
+	return c.Leaf.TLSCertificate(c.Intermediate)
+}
+
+// CertificateMissingIntermediate returns a TLS certificate
+// presenting only the leaf.
+func (c *Chain) CertificateMissingIntermediate() tls.Certificate {
+	return c.Leaf.TLSCertificate()
+}
+
+// CertificateWrongOrder returns a TLS certificate presenting the
+// leaf followed by the root and then the intermediate.
+func (c *Chain) CertificateWrongOrder() tls.Certificate {
+	return c.Leaf.TLSCertificate(c.Root, c.Intermediate)
+}
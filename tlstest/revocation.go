@@ -0,0 +1,231 @@
+package tlstest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// WithCRLDistributionPoints sets the urls the certificate revocation list can be fetched from.
+func WithCRLDistributionPoints(urls ...string) OptFunc {
+	return func(tmpl *x509.Certificate) {
+		tmpl.CRLDistributionPoints = append(tmpl.CRLDistributionPoints, urls...)
+	}
+}
+
+// WithOCSPServer sets the urls of the OCSP responders.
+func WithOCSPServer(urls ...string) OptFunc {
+	return func(tmpl *x509.Certificate) {
+		tmpl.OCSPServer = append(tmpl.OCSPServer, urls...)
+	}
+}
+
+// Status is the revocation status of a certificate.
+type Status int
+
+// Revocation statuses.
+const (
+	StatusGood Status = iota
+	StatusRevoked
+	StatusUnknown
+)
+
+// Responder is a mock revocation responder for certificates issued by a certificate authority.
+//
+// The CRL and OCSP handlers can be served using the mock http server:
+//
+//	r := tlstest.NewResponder(ca)
+//	s.On(http.MethodGet, "/crl").Handle(r.CRLHandler())
+//	s.On(httptest.Anything, "/ocsp*").Handle(r.OCSPHandler())
+type Responder struct {
+	issuer *Certificate
+
+	mu       sync.Mutex
+	statuses map[string]revocation
+	number   int64
+}
+
+type revocation struct {
+	status    Status
+	revokedAt time.Time
+}
+
+// NewResponder returns a revocation responder for the given issuer.
+// All certificates are considered good until their status is set.
+func NewResponder(issuer *Certificate) *Responder {
+	return &Responder{
+		issuer:   issuer,
+		statuses: map[string]revocation{},
+	}
+}
+
+// SetStatus sets the revocation status of the certificate.
+func (r *Responder) SetStatus(cert *Certificate, status Status) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.statuses[cert.Cert.SerialNumber.String()] = revocation{
+		status:    status,
+		revokedAt: time.Now().Add(-time.Minute).UTC().Truncate(time.Second),
+	}
+}
+
+// Revoke marks the certificate as revoked.
+func (r *Responder) Revoke(cert *Certificate) {
+	r.SetStatus(cert, StatusRevoked)
+}
+
+func (r *Responder) status(serial *big.Int) revocation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.statuses[serial.String()]
+}
+
+// CRL returns a DER encoded certificate revocation list of all revoked certificates.
+func (r *Responder) CRL() ([]byte, error) {
+	r.mu.Lock()
+	r.number++
+	tmpl := &x509.RevocationList{
+		Number:     big.NewInt(r.number),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for serial, rev := range r.statuses {
+		if rev.status != StatusRevoked {
+			continue
+		}
+		n, _ := new(big.Int).SetString(serial, 10)
+		tmpl.RevokedCertificateEntries = append(tmpl.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   n,
+			RevocationTime: rev.revokedAt,
+		})
+	}
+	r.mu.Unlock()
+
+	return x509.CreateRevocationList(rand.Reader, tmpl, r.issuer.Cert, r.issuer.Key)
+}
+
+// CRLHandler returns a handler serving the certificate revocation list.
+func (r *Responder) CRLHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		crl, err := r.CRL()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/pkix-crl")
+		_, _ = w.Write(crl)
+	}
+}
+
+// OCSPHandler returns a handler responding to OCSP requests, sent either
+// as a POST body or base64 encoded in the GET request path.
+func (r *Responder) OCSPHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/ocsp-response")
+
+		der, err := readOCSPRequest(req)
+		if err != nil {
+			_, _ = w.Write(ocsp.MalformedRequestErrorResponse)
+			return
+		}
+
+		resp, err := r.OCSP(der)
+		if err != nil {
+			_, _ = w.Write(ocsp.MalformedRequestErrorResponse)
+			return
+		}
+		_, _ = w.Write(resp)
+	}
+}
+
+func readOCSPRequest(req *http.Request) ([]byte, error) {
+	if req.Method == http.MethodPost {
+		return io.ReadAll(req.Body)
+	}
+
+	path := req.URL.EscapedPath()
+	idx := strings.LastIndex(path, "/")
+	enc, err := url.PathUnescape(path[idx+1:])
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(enc)
+}
+
+// OCSP returns a DER encoded OCSP response to the DER encoded request.
+// Requests for certificates of another issuer are answered as unauthorized.
+func (r *Responder) OCSP(der []byte) ([]byte, error) {
+	req, err := ocsp.ParseRequest(der)
+	if err != nil {
+		return nil, err
+	}
+
+	nameHash, keyHash, err := issuerHashes(r.issuer.Cert, req.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(req.IssuerNameHash, nameHash) || !bytes.Equal(req.IssuerKeyHash, keyHash) {
+		return ocsp.UnauthorizedErrorResponse, nil
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	tmpl := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now.Add(-time.Minute),
+		NextUpdate:   now.Add(time.Hour),
+		IssuerHash:   req.HashAlgorithm,
+	}
+	switch rev := r.status(req.SerialNumber); rev.status {
+	case StatusRevoked:
+		tmpl.Status = ocsp.Revoked
+		tmpl.RevokedAt = rev.revokedAt
+	case StatusUnknown:
+		tmpl.Status = ocsp.Unknown
+	}
+
+	return ocsp.CreateResponse(r.issuer.Cert, r.issuer.Cert, tmpl, r.issuer.Key)
+}
+
+// issuerHashes returns the hashes of the issuer name and public key identifying
+// the issuer in OCSP requests.
+func issuerHashes(issuer *x509.Certificate, hash crypto.Hash) (name, key []byte, err error) {
+	if !hash.Available() {
+		return nil, nil, errors.New("tlstest: unsupported ocsp hash algorithm")
+	}
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err = asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, nil, err
+	}
+
+	h := hash.New()
+	_, _ = h.Write(issuer.RawSubject)
+	name = h.Sum(nil)
+
+	h.Reset()
+	_, _ = h.Write(spki.PublicKey.RightAlign())
+	key = h.Sum(nil)
+
+	return name, key, nil
+}
@@ -0,0 +1,125 @@
+package tlstest_test
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hamba/testutils/tlstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestResponder_CRLHandler(t *testing.T) {
+	ca := tlstest.NewCA(t, "Test CA")
+	good := ca.NewLeaf(t, "good")
+	revoked := ca.NewLeaf(t, "revoked")
+	r := tlstest.NewResponder(ca)
+	r.Revoke(revoked)
+	r.SetStatus(good, tlstest.StatusGood)
+
+	rec := httptest.NewRecorder()
+	r.CRLHandler()(rec, httptest.NewRequest(http.MethodGet, "/crl", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	crl, err := x509.ParseRevocationList(rec.Body.Bytes())
+	require.NoError(t, err)
+	assert.NoError(t, crl.CheckSignatureFrom(ca.Cert))
+	require.Len(t, crl.RevokedCertificateEntries, 1)
+	assert.Equal(t, revoked.Cert.SerialNumber, crl.RevokedCertificateEntries[0].SerialNumber)
+}
+
+func TestResponder_OCSPHandler(t *testing.T) {
+	ca := tlstest.NewCA(t, "Test CA")
+	good := ca.NewLeaf(t, "good")
+	revoked := ca.NewLeaf(t, "revoked")
+	unknown := ca.NewLeaf(t, "unknown")
+	r := tlstest.NewResponder(ca)
+	r.Revoke(revoked)
+	r.SetStatus(unknown, tlstest.StatusUnknown)
+
+	tests := []struct {
+		name       string
+		cert       *tlstest.Certificate
+		method     string
+		wantStatus int
+	}{
+		{
+			name:       "good post",
+			cert:       good,
+			method:     http.MethodPost,
+			wantStatus: ocsp.Good,
+		},
+		{
+			name:       "good get",
+			cert:       good,
+			method:     http.MethodGet,
+			wantStatus: ocsp.Good,
+		},
+		{
+			name:       "revoked",
+			cert:       revoked,
+			method:     http.MethodPost,
+			wantStatus: ocsp.Revoked,
+		},
+		{
+			name:       "unknown",
+			cert:       unknown,
+			method:     http.MethodPost,
+			wantStatus: ocsp.Unknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			der, err := ocsp.CreateRequest(tt.cert.Cert, ca.Cert, nil)
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+			r.OCSPHandler()(rec, newOCSPRequest(tt.method, der))
+
+			resp, err := ocsp.ParseResponseForCert(rec.Body.Bytes(), tt.cert.Cert, ca.Cert)
+			require.NoError(t, err)
+			assert.Equal(t, tt.cert.Cert.SerialNumber, resp.SerialNumber)
+			assert.Equal(t, tt.wantStatus, resp.Status)
+			assert.Equal(t, tt.wantStatus == ocsp.Revoked, !resp.RevokedAt.IsZero())
+		})
+	}
+}
+
+func TestResponder_OCSPHandlerHandlesOtherIssuer(t *testing.T) {
+	ca := tlstest.NewCA(t, "Test CA")
+	other := tlstest.NewCA(t, "Other CA")
+	r := tlstest.NewResponder(ca)
+
+	der, err := ocsp.CreateRequest(other.NewLeaf(t, "leaf").Cert, other.Cert, nil)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	r.OCSPHandler()(rec, newOCSPRequest(http.MethodPost, der))
+
+	_, err = ocsp.ParseResponse(rec.Body.Bytes(), ca.Cert)
+	assert.Equal(t, ocsp.ResponseError{Status: ocsp.Unauthorized}, err)
+}
+
+func TestResponder_OCSPHandlerHandlesMalformedRequest(t *testing.T) {
+	r := tlstest.NewResponder(tlstest.NewCA(t, "Test CA"))
+
+	rec := httptest.NewRecorder()
+	r.OCSPHandler()(rec, newOCSPRequest(http.MethodPost, []byte("junk")))
+
+	_, err := ocsp.ParseResponse(rec.Body.Bytes(), nil)
+	assert.Equal(t, ocsp.ResponseError{Status: ocsp.Malformed}, err)
+}
+
+func newOCSPRequest(method string, der []byte) *http.Request {
+	if method == http.MethodPost {
+		return httptest.NewRequest(http.MethodPost, "/ocsp", bytes.NewReader(der))
+	}
+	return httptest.NewRequest(http.MethodGet, "/ocsp/"+url.PathEscape(base64.StdEncoding.EncodeToString(der)), nil)
+}
@@ -0,0 +1,178 @@
+/*
+Package tlstest generates certificates and certificate chains for TLS testing.
+
+A full chain (root, intermediate and leaf) can be generated and served in
+correct or deliberately misconfigured forms:
+
+	func TestClient(t *testing.T) {
+		chain := tlstest.NewChain(t, "127.0.0.1")
+
+		srv := httptest.NewUnstartedServer(handler)
+		srv.TLS = &tls.Config{Certificates: []tls.Certificate{chain.CertificateMissingIntermediate()}}
+		srv.StartTLS()
+		defer srv.Close()
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: chain.RootPool()}}}
+		// Assert the client fails to build the chain.
+	}
+*/
+package tlstest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"time"
+)
+
+// TestingT represents a partial *testing.T.
+type TestingT interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+}
+
+// Certificate is a generated certificate and its private key.
+type Certificate struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+}
+
+// OptFunc configures a leaf certificate.
+type OptFunc func(*x509.Certificate)
+
+// WithHosts sets the DNS names and IP addresses the certificate is valid for.
+func WithHosts(hosts ...string) OptFunc {
+	return func(tmpl *x509.Certificate) {
+		for _, h := range hosts {
+			if ip := net.ParseIP(h); ip != nil {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+				continue
+			}
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+}
+
+// WithIssuingCertificateURL sets the Authority Information Access URLs
+// the issuing certificate can be fetched from.
+func WithIssuingCertificateURL(urls ...string) OptFunc {
+	return func(tmpl *x509.Certificate) {
+		tmpl.IssuingCertificateURL = append(tmpl.IssuingCertificateURL, urls...)
+	}
+}
+
+// WithValidity sets the period the certificate is valid for.
+func WithValidity(notBefore, notAfter time.Time) OptFunc {
+	return func(tmpl *x509.Certificate) {
+		tmpl.NotBefore = notBefore
+		tmpl.NotAfter = notAfter
+	}
+}
+
+// NewCA generates a self-signed root certificate authority.
+func NewCA(t TestingT, cn string) *Certificate {
+	t.Helper()
+
+	return generate(t, caTemplate(cn), nil)
+}
+
+// NewIntermediate generates an intermediate certificate authority signed by c.
+func (c *Certificate) NewIntermediate(t TestingT, cn string) *Certificate {
+	t.Helper()
+
+	return generate(t, caTemplate(cn), c)
+}
+
+// NewLeaf generates a leaf certificate signed by c, usable for
+// both server and client authentication.
+func (c *Certificate) NewLeaf(t TestingT, cn string, opts ...OptFunc) *Certificate {
+	t.Helper()
+
+	tmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(24 * time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, opt := range opts {
+		opt(tmpl)
+	}
+	return generate(t, tmpl, c)
+}
+
+// CertPEM returns the PEM encoded certificate.
+func (c *Certificate) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Cert.Raw})
+}
+
+// KeyPEM returns the PEM encoded private key.
+func (c *Certificate) KeyPEM() []byte {
+	b, _ := x509.MarshalECPrivateKey(c.Key)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b})
+}
+
+// TLSCertificate returns a TLS certificate presenting c followed by the given issuers.
+func (c *Certificate) TLSCertificate(issuers ...*Certificate) tls.Certificate {
+	cert := tls.Certificate{
+		Certificate: [][]byte{c.Cert.Raw},
+		PrivateKey:  c.Key,
+		Leaf:        c.Cert,
+	}
+	for _, issuer := range issuers {
+		cert.Certificate = append(cert.Certificate, issuer.Cert.Raw)
+	}
+	return cert
+}
+
+func caTemplate(cn string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+}
+
+var serialLimit = new(big.Int).Lsh(big.NewInt(1), 128)
+
+func generate(t TestingT, tmpl *x509.Certificate, issuer *Certificate) *Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+		return nil
+	}
+	tmpl.SerialNumber, err = rand.Int(rand.Reader, serialLimit)
+	if err != nil {
+		t.Fatalf("Unable to generate serial number: %v", err)
+		return nil
+	}
+
+	parent, signer := tmpl, key
+	if issuer != nil {
+		parent, signer = issuer.Cert, issuer.Key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %v", err)
+		return nil
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Unable to parse certificate: %v", err)
+		return nil
+	}
+
+	return &Certificate{Cert: cert, Key: key}
+}
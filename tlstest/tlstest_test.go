@@ -0,0 +1,105 @@
+package tlstest_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/hamba/testutils/tlstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCA(t *testing.T) {
+	ca := tlstest.NewCA(t, "Test CA")
+
+	assert.True(t, ca.Cert.IsCA)
+	assert.Equal(t, "Test CA", ca.Cert.Subject.CommonName)
+	assert.Equal(t, ca.Cert.Subject, ca.Cert.Issuer)
+}
+
+func TestCertificate_NewLeaf(t *testing.T) {
+	ca := tlstest.NewCA(t, "Test CA")
+
+	leaf := ca.NewLeaf(t, "leaf",
+		tlstest.WithHosts("example.com", "127.0.0.1"),
+		tlstest.WithIssuingCertificateURL("http://127.0.0.1/ca.crt"),
+	)
+
+	assert.False(t, leaf.Cert.IsCA)
+	assert.Equal(t, []string{"example.com"}, leaf.Cert.DNSNames)
+	assert.Len(t, leaf.Cert.IPAddresses, 1)
+	assert.Equal(t, []string{"http://127.0.0.1/ca.crt"}, leaf.Cert.IssuingCertificateURL)
+	assert.NoError(t, leaf.Cert.CheckSignatureFrom(ca.Cert))
+}
+
+func TestCertificate_PEM(t *testing.T) {
+	ca := tlstest.NewCA(t, "Test CA")
+	leaf := ca.NewLeaf(t, "leaf", tlstest.WithHosts("example.com"))
+
+	_, err := tls.X509KeyPair(leaf.CertPEM(), leaf.KeyPEM())
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(leaf.CertPEM())
+	require.NotNil(t, block)
+	assert.Equal(t, leaf.Cert.Raw, block.Bytes)
+}
+
+func TestChain(t *testing.T) {
+	chain := tlstest.NewChain(t, "example.com")
+
+	tests := []struct {
+		name    string
+		cert    tls.Certificate
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:    "valid",
+			cert:    chain.Certificate(),
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "missing intermediate",
+			cert:    chain.CertificateMissingIntermediate(),
+			wantErr: assert.Error,
+		},
+		{
+			name:    "wrong order",
+			cert:    chain.CertificateWrongOrder(),
+			wantErr: assert.NoError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verify(tt.cert, chain.RootPool(), "example.com")
+
+			tt.wantErr(t, err)
+		})
+	}
+}
+
+// verify verifies the certificate as a client building its chain would.
+func verify(cert tls.Certificate, roots *x509.CertPool, host string) error {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	inters := x509.NewCertPool()
+	for _, der := range cert.Certificate[1:] {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return err
+		}
+		inters.AddCert(c)
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         roots,
+		Intermediates: inters,
+	})
+	return err
+}